@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeMermaid writes g as a Mermaid flowchart: components are chained top to bottom,
+// with dotted links to the templates they run.
+func writeMermaid(w io.Writer, g *graph) error {
+	var (
+		b     strings.Builder
+		label = func(lines []string) string {
+			return strings.ReplaceAll(strings.Join(lines, "<br/>"), `"`, "#quot;")
+		}
+	)
+
+	b.WriteString("flowchart TB\n")
+
+	for _, c := range g.components {
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", c.id, label(c.lines()))
+	}
+
+	for _, t := range g.templates {
+		fmt.Fprintf(&b, "    %s[/\"%s\"/]\n", t.id, label(t.lines()))
+	}
+
+	for i := 1; i < len(g.components); i++ {
+		fmt.Fprintf(&b, "    %s --> %s\n", g.components[i-1].id, g.components[i].id)
+	}
+
+	for _, c := range g.components {
+		for _, q := range c.queries {
+			if len(q.role) > 0 {
+				fmt.Fprintf(&b, "    %s -. %s .-> %s\n", c.id, q.role, q.template.id)
+			} else {
+				fmt.Fprintf(&b, "    %s -.-> %s\n", c.id, q.template.id)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeDOT writes g as a Graphviz digraph, laid out as the Mermaid flowchart is.
+func writeDOT(w io.Writer, g *graph) error {
+	var (
+		b     strings.Builder
+		label = func(lines []string) string {
+			var s = strings.Join(lines, "\n")
+			s = strings.ReplaceAll(s, `\`, `\\`)
+			s = strings.ReplaceAll(s, `"`, `\"`)
+			return strings.ReplaceAll(s, "\n", `\n`)
+		}
+	)
+
+	b.WriteString("digraph pipeline {\n")
+	b.WriteString("    rankdir=TB;\n")
+	b.WriteString("    node [shape=box];\n")
+
+	for _, c := range g.components {
+		fmt.Fprintf(&b, "    %s [label=\"%s\"];\n", c.id, label(c.lines()))
+	}
+
+	for _, t := range g.templates {
+		fmt.Fprintf(&b, "    %s [label=\"%s\", shape=note];\n", t.id, label(t.lines()))
+	}
+
+	for i := 1; i < len(g.components); i++ {
+		fmt.Fprintf(&b, "    %s -> %s;\n", g.components[i-1].id, g.components[i].id)
+	}
+
+	for _, c := range g.components {
+		for _, q := range c.queries {
+			if len(q.role) > 0 {
+				fmt.Fprintf(&b, "    %s -> %s [style=dashed, label=\"%s\"];\n", c.id, q.template.id, label([]string{q.role}))
+			} else {
+				fmt.Fprintf(&b, "    %s -> %s [style=dashed];\n", c.id, q.template.id)
+			}
+		}
+	}
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,239 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/agnosticeng/agt/cmd/run"
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/pipeline"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/samber/lo"
+	"github.com/urfave/cli/v2"
+)
+
+var Flags = []cli.Flag{
+	&cli.StringFlag{Name: "template-path"},
+	&cli.StringSliceFlag{Name: "var"},
+	&cli.StringFlag{Name: "format", Value: "mermaid"},
+}
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "graph",
+		Flags: Flags,
+		Action: func(ctx *cli.Context) error {
+			var (
+				path = ctx.Args().Get(0)
+				vars = run.Vars(ctx.StringSlice("var"))
+			)
+
+			if len(path) == 0 {
+				return fmt.Errorf("pipeline path must be specified")
+			}
+
+			conf, err := run.LoadConfig(ctx.Context, path, vars)
+
+			if err != nil {
+				return err
+			}
+
+			u, err := run.TemplatesURL(path, ctx.String("template-path"))
+
+			if err != nil {
+				return err
+			}
+
+			tmpl, err := utils.LoadTemplates(ctx.Context, u)
+
+			if err != nil {
+				return err
+			}
+
+			g, err := newGraph(conf.PipelineConfig, tmpl)
+
+			if err != nil {
+				return err
+			}
+
+			switch ctx.String("format") {
+			case "mermaid":
+				return writeMermaid(os.Stdout, g)
+			case "dot":
+				return writeDOT(os.Stdout, g)
+			default:
+				return fmt.Errorf("unknown graph format %s: must be mermaid or dot", ctx.String("format"))
+			}
+		},
+	}
+}
+
+// graph is the shape of a pipeline: its components, chained in the order tasks flow through them,
+// and the templates they reference.
+type graph struct {
+	components []*component
+	templates  []*templateNode
+}
+
+type component struct {
+	id       string
+	title    string
+	settings []string
+	queries  []queryEdge
+}
+
+// queryEdge links a component to a template it runs, role telling what the query is for when the
+// component runs queries for different purposes (e.g. the enter query of a buffer).
+type queryEdge struct {
+	role     string
+	template *templateNode
+}
+
+type templateNode struct {
+	id      string
+	name    string
+	vars    []string
+	missing bool
+}
+
+// newGraph builds the graph of a pipeline from the queries pipeline.QueriesVars lists for each component,
+// so that it shows the same queries agt render does.
+func newGraph(conf pipeline.PipelineConfig, tmpl *template.Template) (*graph, error) {
+	var (
+		g         graph
+		templates = make(map[string]*templateNode)
+	)
+
+	var ref = func(c *component, role string, query ch.QueryRef) {
+		var t, found = templates[query.Name]
+
+		if !found {
+			t = &templateNode{
+				id:      fmt.Sprintf("template_%d", len(g.templates)),
+				name:    query.Name,
+				vars:    utils.TemplateVars(tmpl, query.Name),
+				missing: tmpl.Lookup(query.Name) == nil,
+			}
+
+			templates[query.Name] = t
+			g.templates = append(g.templates, t)
+		}
+
+		c.queries = append(c.queries, queryEdge{role: role, template: t})
+	}
+
+	for _, name := range conf.Components() {
+		queries, err := conf.QueriesVars(name, nil, nil, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "init" && len(queries) == 0 {
+			continue
+		}
+
+		var c = newComponent(conf, name)
+
+		for _, query := range queries {
+			ref(c, query.Role, query.Query)
+		}
+
+		g.components = append(g.components, c)
+	}
+
+	return &g, nil
+}
+
+// newComponent returns the node of a pipeline component, as named by pipeline.PipelineConfig.Components,
+// labelled with its settings.
+func newComponent(conf pipeline.PipelineConfig, name string) *component {
+	var settings []string
+
+	switch name {
+	case "init":
+		settings = []string{setting("Engine", conf.Init.Engine), setting("Session", conf.Init.Session)}
+
+	case "source":
+		settings = []string{
+			setting("Engine", conf.Source.Engine),
+			setting("PollInterval", conf.Source.PollInterval),
+			setting("StopAfter", conf.Source.StopAfter),
+			setting("StopOnEmpty", conf.Source.StopOnEmpty),
+		}
+
+	case "finalizer":
+		settings = []string{setting("Engine", conf.Finalizer.Engine), setting("Session", conf.Finalizer.Session)}
+
+	default:
+		var (
+			i, _  = strconv.Atoi(name)
+			stage = conf.Stages[i]
+		)
+
+		settings = []string{setting("Engine", stage.Engine)}
+
+		switch {
+		case stage.Execute != nil:
+			settings = append(settings, setting("PoolSize", stage.Execute.PoolSize), setting("Session", stage.Execute.Session))
+
+		case stage.Buffer != nil:
+			settings = append(
+				settings,
+				setting("MaxRows", stage.Buffer.MaxRows),
+				setting("MaxDuration", stage.Buffer.MaxDuration),
+				setting("Session", stage.Buffer.Session),
+			)
+
+		case stage.Metrics != nil:
+			var names = lo.Map(stage.Metrics.Metrics, func(m pipeline.MetricConfig, _ int) string { return m.Name })
+			settings = append(settings, setting("Metrics", strings.Join(names, ", ")))
+
+		case stage.Sleep != nil:
+			settings = append(settings, setting("Duration", stage.Sleep.Duration))
+
+		case stage.Debug != nil:
+			settings = append(settings, setting("Id", stage.Debug.Id))
+		}
+
+		return &component{
+			id:       "stage_" + name,
+			title:    fmt.Sprintf("stage %s: %s", name, stage.Type()),
+			settings: lo.Compact(settings),
+		}
+	}
+
+	return &component{id: name, title: name, settings: lo.Compact(settings)}
+}
+
+// setting formats a setting as a label line, or returns an empty string for a zero value.
+func setting[T comparable](name string, value T) string {
+	var zero T
+
+	if value == zero {
+		return ""
+	}
+
+	return fmt.Sprintf("%s: %v", name, value)
+}
+
+func (t *templateNode) lines() []string {
+	var lines = []string{t.name}
+
+	if t.missing {
+		lines = append(lines, "(missing)")
+	}
+
+	if len(t.vars) > 0 {
+		lines = append(lines, "vars: "+strings.Join(t.vars, ", "))
+	}
+
+	return lines
+}
+
+func (c *component) lines() []string {
+	return append([]string{c.title}, c.settings...)
+}
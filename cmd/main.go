@@ -5,8 +5,12 @@ import (
 	"log/slog"
 	"os"
 
+	"github.com/agnosticeng/agt/cmd/graph"
+	"github.com/agnosticeng/agt/cmd/query"
 	"github.com/agnosticeng/agt/cmd/render"
 	"github.com/agnosticeng/agt/cmd/run"
+	"github.com/agnosticeng/agt/cmd/shell"
+	"github.com/agnosticeng/agt/cmd/test"
 	"github.com/agnosticeng/cliutils"
 	"github.com/agnosticeng/cnf"
 	"github.com/agnosticeng/cnf/providers/env"
@@ -31,6 +35,10 @@ func main() {
 		Commands: []*cli.Command{
 			run.Command(),
 			render.Command(),
+			test.Command(),
+			shell.Command(),
+			query.Command(),
+			graph.Command(),
 		},
 	}
 
@@ -0,0 +1,209 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/template"
+
+	"github.com/agnosticeng/agt/cmd/run"
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/output"
+	"github.com/agnosticeng/agt/internal/pipeline"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// inlineTemplate is the name SQL given on the command line is parsed under.
+const inlineTemplate = "<query>"
+
+var Flags = []cli.Flag{
+	&cli.StringFlag{Name: "pipeline", Required: true},
+	&cli.StringFlag{Name: "template-path"},
+	&cli.StringSliceFlag{Name: "var"},
+	&cli.StringFlag{Name: "engine"},
+	&cli.BoolFlag{Name: "init"},
+	&cli.StringFlag{Name: "format", Value: string(output.Table)},
+	&cli.StringFlag{Name: "ch-format"},
+	&cli.StringFlag{Name: "output"},
+	&cli.BoolFlag{Name: "metadata"},
+}
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "query",
+		Flags: Flags,
+		Action: func(ctx *cli.Context) (err error) {
+			var (
+				arg                  = ctx.Args().Get(0)
+				path                 = ctx.String("pipeline")
+				vars                 = run.Vars(ctx.StringSlice("var"))
+				chFormat             = ctx.String("ch-format")
+				sigCtx, sigCtxCancel = signal.NotifyContext(ctx.Context, os.Interrupt, syscall.SIGTERM)
+			)
+
+			defer sigCtxCancel()
+
+			if len(arg) == 0 {
+				return fmt.Errorf("template name or SQL query must be specified")
+			}
+
+			format, err := output.ParseFormat(ctx.String("format"))
+
+			if err != nil {
+				return err
+			}
+
+			conf, err := run.LoadConfig(sigCtx, path, vars)
+
+			if err != nil {
+				return err
+			}
+
+			u, err := run.TemplatesURL(path, ctx.String("template-path"))
+
+			if err != nil {
+				return err
+			}
+
+			tmpl, err := utils.LoadTemplates(sigCtx, u)
+
+			if err != nil {
+				return err
+			}
+
+			name, err := resolveTemplate(tmpl, arg)
+
+			if err != nil {
+				return err
+			}
+
+			runUUID, err := run.SetRunUUID(vars)
+
+			if err != nil {
+				return err
+			}
+
+			engineName, err := conf.EngineName(ctx.String("engine"))
+
+			if err != nil {
+				return err
+			}
+
+			eng, stop, err := run.StartEngine(sigCtx, conf, engineName)
+
+			if err != nil {
+				return err
+			}
+
+			defer stop()
+
+			if ctx.Bool("init") {
+				initVars, err := runInit(sigCtx, conf, eng, engineName, tmpl, vars)
+
+				if err != nil {
+					return err
+				}
+
+				vars = utils.MergeMaps(vars, initVars)
+			}
+
+			query, err := utils.RenderTemplate(tmpl, name, vars)
+
+			if err != nil {
+				return fmt.Errorf("failed to render %s template: %w", name, err)
+			}
+
+			var w io.Writer = os.Stdout
+
+			if outputPath := ctx.String("output"); len(outputPath) > 0 {
+				f, err := os.Create(outputPath)
+
+				if err != nil {
+					return err
+				}
+
+				defer func() {
+					if closeErr := f.Close(); closeErr != nil && err == nil {
+						err = fmt.Errorf("failed to close %s: %w", outputPath, closeErr)
+					}
+				}()
+
+				w = f
+			}
+
+			// inline SQL has no template, like a missing part of the query ID
+			var queryTemplate = name
+
+			if name == inlineTemplate {
+				queryTemplate = ""
+			}
+
+			var (
+				queryCtx = ch.WithQueryID(sigCtx, pipeline.QueryID(runUUID, "", "", queryTemplate))
+				md       *engine.QueryMetadata
+			)
+
+			if len(chFormat) > 0 {
+				md, err = engine.QueryStream(queryCtx, eng, query, chFormat, w)
+			} else {
+				var rows []map[string]any
+
+				if rows, md, err = eng.Query(queryCtx, query); err == nil {
+					err = output.Write(w, format, rows, md.Columns)
+				}
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if ctx.Bool("metadata") {
+				return output.WriteMetadata(os.Stderr, md)
+			}
+
+			return nil
+		},
+	}
+}
+
+// resolveTemplate returns the name of the template to render: arg itself if it names a template,
+// otherwise arg is parsed as the SQL of a new template, so that it can use vars and other templates.
+func resolveTemplate(tmpl *template.Template, arg string) (string, error) {
+	if tmpl.Lookup(arg) != nil {
+		return arg, nil
+	}
+
+	if _, err := tmpl.New(inlineTemplate).Parse(arg); err != nil {
+		return "", fmt.Errorf("%s is neither a template nor a valid query: %w", arg, err)
+	}
+
+	return inlineTemplate, nil
+}
+
+// runInit runs the init queries of the pipeline, on eng if it is the init engine or on an engine
+// started for the occasion otherwise, and returns the vars they output.
+func runInit(ctx context.Context, conf run.Config, eng engine.Engine, engineName string, tmpl *template.Template, vars map[string]any) (map[string]any, error) {
+	initEngine, err := conf.EngineName(conf.Init.Engine)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if initEngine != engineName {
+		initEng, stop, err := run.StartEngine(ctx, conf, initEngine)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer stop()
+		eng = initEng
+	}
+
+	return pipeline.Init(ctx, eng, utils.NewTemplateStore(tmpl), vars, conf.Init)
+}
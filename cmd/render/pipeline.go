@@ -0,0 +1,139 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/agnosticeng/agt/cmd/run"
+	"github.com/agnosticeng/agt/internal/pipeline"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// renderPipeline renders the queries of a pipeline with the vars pipeline.Run would give them:
+// the run vars with UUID and, if asked, the outputs of the init queries, plus sample task vars.
+func renderPipeline(ctx *cli.Context, tmpl *template.Template, path string, vars map[string]any) error {
+	var (
+		filter     = ctx.String("filter")
+		components []string
+	)
+
+	conf, err := run.LoadConfig(ctx.Context, path, vars)
+
+	if err != nil {
+		return err
+	}
+
+	taskVars, err := parseVars(ctx.String("task-vars"))
+
+	if err != nil {
+		return fmt.Errorf("invalid task vars: %w", err)
+	}
+
+	batchVars, err := parseVars(ctx.String("batch-vars"))
+
+	if err != nil {
+		return fmt.Errorf("invalid batch vars: %w", err)
+	}
+
+	if _, err := run.SetRunUUID(vars); err != nil {
+		return err
+	}
+
+	if ctx.Bool("init") {
+		initVars, err := runInit(ctx.Context, conf, tmpl, vars)
+
+		if err != nil {
+			return err
+		}
+
+		vars = utils.MergeMaps(vars, initVars)
+	}
+
+	if stage := ctx.String("stage"); len(stage) > 0 {
+		components = []string{stage}
+	} else {
+		components = conf.Components()
+	}
+
+	for _, component := range components {
+		queries, err := conf.QueriesVars(component, vars, taskVars, batchVars)
+
+		if err != nil {
+			return err
+		}
+
+		for _, query := range queries {
+			if len(filter) > 0 {
+				if m, _ := filepath.Match(filter, query.Query.Name); !m {
+					continue
+				}
+			}
+
+			fmt.Println("--------------------------------------------------------------------------------")
+			fmt.Println(query.Component + " / " + query.Query.Name)
+			fmt.Println("--------------------------------------------------------------------------------")
+
+			str, err := utils.RenderTemplate(tmpl, query.Query.Name, query.Vars)
+
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(str)
+		}
+	}
+
+	return nil
+}
+
+// runInit starts the engine of the init queries and runs them to get the vars they output.
+func runInit(ctx context.Context, conf run.Config, tmpl *template.Template, vars map[string]any) (map[string]any, error) {
+	eng, stop, err := run.StartEngine(ctx, conf, conf.Init.Engine)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer stop()
+	return pipeline.Init(ctx, eng, utils.NewTemplateStore(tmpl), vars, conf.Init)
+}
+
+// parseVars parses a JSON object, given inline or as @<path> to read it from a file.
+// Numbers are kept as written rather than converted to floats.
+func parseVars(s string) (map[string]any, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var data = []byte(s)
+
+	if path, found := strings.CutPrefix(s, "@"); found {
+		content, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data = content
+	}
+
+	var (
+		vars map[string]any
+		dec  = json.NewDecoder(bytes.NewReader(data))
+	)
+
+	dec.UseNumber()
+
+	if err := dec.Decode(&vars); err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
@@ -2,9 +2,12 @@ package render
 
 import (
 	"fmt"
-	"net/url"
 	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
 
+	"github.com/agnosticeng/agt/cmd/run"
 	"github.com/agnosticeng/agt/internal/utils"
 	"github.com/urfave/cli/v2"
 )
@@ -12,6 +15,14 @@ import (
 var Flags = []cli.Flag{
 	&cli.StringSliceFlag{Name: "var"},
 	&cli.StringFlag{Name: "filter"},
+	&cli.StringFlag{Name: "golden"},
+	&cli.StringFlag{Name: "var-sets"},
+	&cli.BoolFlag{Name: "update"},
+	&cli.StringFlag{Name: "pipeline"},
+	&cli.StringFlag{Name: "stage"},
+	&cli.StringFlag{Name: "task-vars"},
+	&cli.StringFlag{Name: "batch-vars"},
+	&cli.BoolFlag{Name: "init"},
 }
 
 func Command() *cli.Command {
@@ -20,12 +31,15 @@ func Command() *cli.Command {
 		Flags: Flags,
 		Action: func(ctx *cli.Context) error {
 			var (
-				path   = ctx.Args().Get(0)
-				vars   = utils.ParseKeyValues(ctx.StringSlice("var"), "=")
-				filter = ctx.String("filter")
+				path         = ctx.Args().Get(0)
+				vars         = run.Vars(ctx.StringSlice("var"))
+				filter       = ctx.String("filter")
+				golden       = ctx.String("golden")
+				pipelinePath = ctx.String("pipeline")
 			)
 
-			u, err := url.Parse(path)
+			// templates are looked up next to the pipeline file by default, as agt run does
+			u, err := run.TemplatesURL(pipelinePath, path)
 
 			if err != nil {
 				return err
@@ -37,13 +51,25 @@ func Command() *cli.Command {
 				return err
 			}
 
-			for _, tmpl := range tmpl.Templates() {
-				if len(filter) > 0 {
-					if m, _ := filepath.Match(filter, tmpl.Name()); !m {
-						continue
-					}
+			if len(golden) > 0 && len(pipelinePath) > 0 {
+				return fmt.Errorf("--golden cannot be combined with --pipeline")
+			}
+
+			if len(pipelinePath) > 0 {
+				return renderPipeline(ctx, tmpl, pipelinePath, vars)
+			}
+
+			if len(golden) > 0 {
+				varSets, err := loadVarSets(ctx.Context, ctx.String("var-sets"), vars)
+
+				if err != nil {
+					return err
 				}
 
+				return snapshot(selectTemplates(tmpl, filter), varSets, golden, filter, ctx.Bool("update"))
+			}
+
+			for _, tmpl := range selectTemplates(tmpl, filter) {
 				fmt.Println("--------------------------------------------------------------------------------")
 				fmt.Println(tmpl.Name())
 				fmt.Println("--------------------------------------------------------------------------------")
@@ -61,3 +87,20 @@ func Command() *cli.Command {
 		},
 	}
 }
+
+func selectTemplates(tmpl *template.Template, filter string) []*template.Template {
+	var res []*template.Template
+
+	for _, tmpl := range tmpl.Templates() {
+		if len(filter) > 0 {
+			if m, _ := filepath.Match(filter, tmpl.Name()); !m {
+				continue
+			}
+		}
+
+		res = append(res, tmpl)
+	}
+
+	slices.SortFunc(res, func(a, b *template.Template) int { return strings.Compare(a.Name(), b.Name()) })
+	return res
+}
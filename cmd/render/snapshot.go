@@ -0,0 +1,141 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/agnosticeng/cnf"
+	"github.com/agnosticeng/objstr"
+)
+
+const defaultVarSet = "default"
+
+// loadVarSets reads named var sets from a YAML file mapping each set name to its vars.
+// Without a file, a single "default" set is used. vars override the vars of every set.
+func loadVarSets(ctx context.Context, path string, vars map[string]any) (map[string]map[string]any, error) {
+	if len(path) == 0 {
+		return map[string]map[string]any{defaultVarSet: vars}, nil
+	}
+
+	varSets, err := cnf.LoadStruct[map[string]map[string]any](
+		cnf.WithProvider(utils.NewCnfProvider(objstr.FromContextOrDefault(ctx), path, vars)),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load var sets: %w", err)
+	}
+
+	if len(varSets) == 0 {
+		return nil, fmt.Errorf("no var set found in %s", path)
+	}
+
+	for name, set := range varSets {
+		varSets[name] = utils.MergeMaps(set, vars)
+	}
+
+	return varSets, nil
+}
+
+// snapshot renders every template with every var set and compares the output to the golden file
+// <golden>/<var set>/<template>.golden (an extension that is not loaded as a template).
+// Missing golden files and stale ones, left by templates or var sets that no longer exist, are failures.
+// With update, golden files are written and stale ones removed instead. filter limits the stale files
+// considered to those of the templates it matches, as it does for tmpls.
+func snapshot(tmpls []*template.Template, varSets map[string]map[string]any, golden string, filter string, update bool) error {
+	var (
+		written  int
+		failed   int
+		expected = make(map[string]bool)
+	)
+
+	for _, name := range slices.Sorted(maps.Keys(varSets)) {
+		for _, tmpl := range tmpls {
+			str, err := utils.RenderTemplate(tmpl, tmpl.Name(), varSets[name])
+
+			if err != nil {
+				return fmt.Errorf("failed to render %s with var set %s: %w", tmpl.Name(), name, err)
+			}
+
+			var path = filepath.Join(golden, name, tmpl.Name()+".golden")
+
+			expected[path] = true
+
+			if update {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					return err
+				}
+
+				if err := os.WriteFile(path, []byte(str), 0644); err != nil {
+					return err
+				}
+
+				written++
+				continue
+			}
+
+			content, err := os.ReadFile(path)
+
+			if os.IsNotExist(err) {
+				fmt.Printf("missing snapshot %s\n", path)
+				failed++
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if diff := utils.Diff(path, string(content), str); len(diff) > 0 {
+				fmt.Print(diff)
+				failed++
+			}
+		}
+	}
+
+	stale, err := filepath.Glob(filepath.Join(golden, "*", "*.golden"))
+
+	if err != nil {
+		return err
+	}
+
+	for _, path := range stale {
+		if expected[path] {
+			continue
+		}
+
+		if len(filter) > 0 {
+			if m, _ := filepath.Match(filter, strings.TrimSuffix(filepath.Base(path), ".golden")); !m {
+				continue
+			}
+		}
+
+		if update {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+
+			fmt.Printf("removed stale snapshot %s\n", path)
+			continue
+		}
+
+		fmt.Printf("stale snapshot %s\n", path)
+		failed++
+	}
+
+	if written > 0 {
+		fmt.Printf("%d snapshot(s) written\n", written)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d snapshot(s) missing, stale or different, run with --update to accept the changes", failed)
+	}
+
+	return nil
+}
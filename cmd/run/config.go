@@ -0,0 +1,72 @@
+package run
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine/impl"
+	"github.com/agnosticeng/agt/internal/metrics"
+	"github.com/agnosticeng/agt/internal/pipeline"
+	"github.com/agnosticeng/agt/internal/tracing"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/agnosticeng/cnf"
+	"github.com/agnosticeng/cnf/providers/env"
+	"github.com/agnosticeng/objstr"
+)
+
+type Config struct {
+	pipeline.PipelineConfig
+	Engine        impl.EngineConfig
+	Engines       map[string]impl.EngineConfig
+	DefaultEngine string
+	StartupProbe  ch.StartupProbeConfig
+	// PromAddr serves /metrics and the read-only admin endpoints, on every interface by default.
+	PromAddr string
+	// ControlAddr serves the unauthenticated /pause, /resume and /stop-source endpoints.
+	// It defaults to the loopback interface, so that only local processes can control the pipeline.
+	ControlAddr string
+	// DisableHTTP disables both servers.
+	DisableHTTP bool
+	Templates   TemplateReloadConfig
+	Metrics     metrics.MetricsConfig
+	Tracing     tracing.TracingConfig
+}
+
+// LoadConfig loads a pipeline file, rendered with vars, and overrides it with AGT_ prefixed env vars.
+func LoadConfig(ctx context.Context, path string, vars map[string]any) (Config, error) {
+	return cnf.LoadStruct[Config](
+		cnf.WithProvider(utils.NewCnfProvider(objstr.FromContextOrDefault(ctx), path, vars)),
+		cnf.WithProvider(env.NewEnvProvider("AGT")),
+		cnf.WithMapstructureHooks(ch.StringToQueryRefHookFunc()),
+	)
+}
+
+// EngineConfigs returns the named engines of the pipeline, the single Engine being named "default".
+// Setting both is an error, since Engine would otherwise be silently ignored.
+func (conf Config) EngineConfigs() (map[string]impl.EngineConfig, error) {
+	if len(conf.Engines) == 0 {
+		return map[string]impl.EngineConfig{"default": conf.Engine}, nil
+	}
+
+	if conf.Engine != (impl.EngineConfig{}) {
+		return nil, fmt.Errorf("Engine and Engines cannot both be set")
+	}
+
+	return conf.Engines, nil
+}
+
+// EngineName resolves the engine a component refers to, an empty name meaning the default engine.
+func (conf Config) EngineName(name string) (string, error) {
+	if len(name) > 0 {
+		return name, nil
+	}
+
+	confs, err := conf.EngineConfigs()
+
+	if err != nil {
+		return "", err
+	}
+
+	return impl.DefaultEngineName(confs, conf.DefaultEngine)
+}
@@ -0,0 +1,60 @@
+package run
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/engine/impl"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// StartEngine creates a single engine of the pipeline, the default one if name is empty, starts it
+// and waits for it to answer. The returned function stops the engine and waits for it to exit.
+func StartEngine(ctx context.Context, conf Config, name string) (engine.Engine, func(), error) {
+	name, err := conf.EngineName(name)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var logger = slogctx.FromCtx(ctx).With("engine", name)
+
+	confs, err := conf.EngineConfigs()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	engineConf, found := confs[name]
+
+	if !found {
+		return nil, nil, fmt.Errorf("engine %s is not configured", name)
+	}
+
+	eng, err := impl.NewEngine(ctx, engineConf)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create engine %s: %w", name, err)
+	}
+
+	if err := eng.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start engine %s: %w", name, err)
+	}
+
+	var stop = func() {
+		eng.Stop()
+
+		if err := eng.Wait(); err != nil {
+			logger.Error("engine stopped", "error", err.Error())
+		}
+	}
+
+	if err := ch.RunStartupProbe(slogctx.NewCtx(ctx, logger), eng, conf.StartupProbe); err != nil {
+		stop()
+		return nil, nil, fmt.Errorf("engine %s: %w", name, err)
+	}
+
+	return eng, stop, nil
+}
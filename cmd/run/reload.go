@@ -0,0 +1,104 @@
+package run
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/pipeline"
+	"github.com/agnosticeng/agt/internal/utils"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+type TemplateReloadConfig struct {
+	// Watch polls the template location for changes; SIGHUP always triggers a reload.
+	Watch        bool
+	PollInterval time.Duration
+}
+
+func (conf TemplateReloadConfig) WithDefaults() TemplateReloadConfig {
+	if conf.PollInterval == 0 {
+		conf.PollInterval = 5 * time.Second
+	}
+
+	return conf
+}
+
+// reloadTemplates swaps the templates held by store whenever SIGHUP is received or, when watching is enabled,
+// whenever the templates under target change. A reload that fails to parse or no longer provides
+// every query referenced by the pipeline is rejected and the current templates are kept.
+func reloadTemplates(
+	ctx context.Context,
+	store *utils.TemplateStore,
+	target *url.URL,
+	pipelineConf pipeline.PipelineConfig,
+	conf TemplateReloadConfig,
+) {
+	var (
+		logger  = slogctx.FromCtx(ctx)
+		sigchan = make(chan os.Signal, 1)
+		tick    <-chan time.Time
+		last    string
+	)
+
+	conf = conf.WithDefaults()
+
+	signal.Notify(sigchan, syscall.SIGHUP)
+	defer signal.Stop(sigchan)
+
+	if conf.Watch {
+		var ticker = time.NewTicker(conf.PollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+
+		fingerprint, err := utils.TemplatesFingerprint(ctx, target)
+
+		if err != nil {
+			logger.Warn("failed to fingerprint templates", "error", err.Error())
+		}
+
+		last = fingerprint
+	}
+
+	var reload = func(reason string) {
+		tmpl, err := utils.LoadTemplates(ctx, target)
+
+		if err == nil {
+			err = pipeline.ValidateTemplates(tmpl, pipelineConf)
+		}
+
+		if err != nil {
+			logger.Error("templates reload rejected", "reason", reason, "error", err.Error())
+			return
+		}
+
+		store.Store(tmpl)
+		logger.Info("templates reloaded", "reason", reason)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigchan:
+			reload("signal")
+		case <-tick:
+			fingerprint, err := utils.TemplatesFingerprint(ctx, target)
+
+			if err != nil {
+				logger.Warn("failed to fingerprint templates", "error", err.Error())
+				continue
+			}
+
+			if fingerprint == last {
+				continue
+			}
+
+			last = fingerprint
+			reload("change")
+		}
+	}
+}
@@ -1,57 +1,49 @@
 package run
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/agnosticeng/agt/internal/admin"
 	"github.com/agnosticeng/agt/internal/ch"
 	"github.com/agnosticeng/agt/internal/engine/impl"
+	"github.com/agnosticeng/agt/internal/metrics"
 	"github.com/agnosticeng/agt/internal/pipeline"
+	"github.com/agnosticeng/agt/internal/tracing"
 	"github.com/agnosticeng/agt/internal/utils"
-	"github.com/agnosticeng/cnf"
-	"github.com/agnosticeng/cnf/providers/env"
-	"github.com/agnosticeng/objstr"
 	"github.com/agnosticeng/panicsafe"
 	"github.com/agnosticeng/tallyctx"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/uber-go/tally/v4"
-	promreporter "github.com/uber-go/tally/v4/prometheus"
+	"github.com/samber/lo"
 	"github.com/urfave/cli/v2"
 	slogctx "github.com/veqryn/slog-context"
 	"golang.org/x/sync/errgroup"
 )
 
+// shutdownTimeout bounds the final flush of traces and metrics, so that an unreachable backend
+// does not keep agt from exiting.
+const shutdownTimeout = 10 * time.Second
+
 var Flags = []cli.Flag{
 	&cli.StringFlag{Name: "template-path"},
 	&cli.StringSliceFlag{Name: "var"},
 }
 
-type config struct {
-	pipeline.PipelineConfig
-	Engine       impl.EngineConfig
-	StartupProbe ch.StartupProbeConfig
-	PromAddr     string
-}
-
 func Command() *cli.Command {
 	return &cli.Command{
 		Name:  "run",
 		Flags: Flags,
 		Action: func(ctx *cli.Context) error {
 			var (
-				logger       = slogctx.FromCtx(ctx.Context)
-				path         = ctx.Args().Get(0)
-				templatePath = ctx.String("template-path")
-				vars         = utils.MergeMaps(
-					utils.ParseKeyValuesWithPrefix(os.Environ(), "=", "AGT__VAR__"),
-					utils.ParseKeyValues(ctx.StringSlice("var"), "="),
-				)
+				logger               = slogctx.FromCtx(ctx.Context)
+				path                 = ctx.Args().Get(0)
+				templatePath         = ctx.String("template-path")
+				vars                 = Vars(ctx.StringSlice("var"))
 				sigCtx, sigCtxCancel = signal.NotifyContext(ctx.Context, os.Interrupt, syscall.SIGTERM)
 			)
 
@@ -61,95 +53,163 @@ func Command() *cli.Command {
 				return fmt.Errorf("pipeline path must be specified")
 			}
 
-			conf, err := cnf.LoadStruct[config](
-				cnf.WithProvider(utils.NewCnfProvider(objstr.FromContextOrDefault(sigCtx), path, vars)),
-				cnf.WithProvider(env.NewEnvProvider("AGT")),
-				cnf.WithMapstructureHooks(ch.StringToQueryRefHookFunc()),
-			)
+			conf, err := LoadConfig(sigCtx, path, vars)
 
 			if err != nil {
 				return err
 			}
 
-			u, err := url.Parse(path)
+			u, err := TemplatesURL(path, templatePath)
 
 			if err != nil {
 				return err
 			}
 
-			if len(templatePath) == 0 {
-				u.Path = filepath.Dir(u.Path)
+			tmpl, err := utils.LoadTemplates(sigCtx, u)
+
+			if err != nil {
+				return err
 			}
 
-			tmpl, err := utils.LoadTemplates(sigCtx, u)
+			if err := pipeline.ValidateTemplates(tmpl, conf.PipelineConfig); err != nil {
+				return err
+			}
+
+			var templates = utils.NewTemplateStore(tmpl)
+
+			shutdownTracing, err := tracing.Setup(sigCtx, conf.Tracing)
 
 			if err != nil {
 				return err
 			}
 
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				defer cancel()
+
+				if err := shutdownTracing(ctx); err != nil {
+					logger.Error("failed to flush traces", "error", err.Error())
+				}
+			}()
+
 			var pipelineCtx, pipelineCancel = signal.NotifyContext(sigCtx, syscall.SIGTERM)
 			defer pipelineCancel()
 
-			var promReporter = promreporter.NewReporter(promreporter.Options{
-				OnRegisterError: func(err error) {
-					logger.Log(sigCtx, -30, "failed to register metric", "error", err.Error())
-				},
-			})
+			m, err := metrics.Setup(sigCtx, conf.Metrics)
 
-			scope, scopeCloser := tally.NewRootScope(tally.ScopeOptions{
-				Prefix:         "agt",
-				CachedReporter: promReporter,
-				Separator:      promreporter.DefaultSeparator,
-			}, 1*time.Second)
+			if err != nil {
+				return err
+			}
 
-			defer scopeCloser.Close()
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				defer cancel()
+
+				if err := m.Close(ctx); err != nil {
+					logger.Error("failed to flush metrics", "error", err.Error())
+				}
+			}()
 
 			if len(conf.PromAddr) == 0 {
 				conf.PromAddr = ":9999"
 			}
 
-			go func() {
-				logger.Info("prometheus HTTP server started", "addr", conf.PromAddr)
-				http.ListenAndServe(conf.PromAddr, promhttp.Handler())
-			}()
+			if len(conf.ControlAddr) == 0 {
+				conf.ControlAddr = "127.0.0.1:9998"
+			}
 
-			pipelineCtx = tallyctx.NewContext(pipelineCtx, scope)
+			var (
+				mux        = http.NewServeMux()
+				controlMux = http.NewServeMux()
+				state      = pipeline.NewState()
+			)
+
+			if m.Handler != nil {
+				mux.Handle("/metrics", m.Handler)
+			}
 
-			engine, err := impl.NewEngine(pipelineCtx, conf.Engine)
+			pipelineCtx = tallyctx.NewContext(pipelineCtx, m.Scope)
+			pipelineCtx = pipeline.WithState(pipelineCtx, state)
+
+			engineConfs, err := conf.EngineConfigs()
 
 			if err != nil {
 				return err
 			}
 
-			if err := engine.Start(); err != nil {
+			engines, err := impl.NewEngines(pipelineCtx, engineConfs, conf.DefaultEngine)
+
+			if err != nil {
 				return err
 			}
 
-			var group, groupCtx = errgroup.WithContext(pipelineCtx)
+			var adminServer = admin.NewServer(
+				engines,
+				lo.MapValues(engineConfs, func(conf impl.EngineConfig, _ string) string { return conf.Type() }),
+				state,
+			)
 
-			group.Go(panicsafe.Func(func() error {
-				var err = engine.Wait()
+			adminServer.Register(mux)
+			adminServer.RegisterControls(controlMux)
 
-				if err != nil {
-					logger.Error("engine stopped", "error", err.Error())
-				} else {
-					logger.Info("engine stopped")
+			if !conf.DisableHTTP {
+				if err := serveHTTP(sigCtx, conf.PromAddr, mux); err != nil {
+					return err
 				}
 
-				return err
-			}))
+				if err := serveHTTP(sigCtx, conf.ControlAddr, controlMux); err != nil {
+					return err
+				}
+			}
 
-			group.Go(panicsafe.Func(func() error {
-				defer engine.Stop()
+			for i, name := range engines.Names() {
+				if err := engines.Engines[name].Start(); err != nil {
+					for _, started := range engines.Names()[:i] {
+						engines.Engines[started].Stop()
+					}
+
+					return fmt.Errorf("failed to start engine %s: %w", name, err)
+				}
+			}
+
+			var group, groupCtx = errgroup.WithContext(pipelineCtx)
+
+			go handleControlSignals(groupCtx, state)
+			go reloadTemplates(groupCtx, templates, u, conf.PipelineConfig, conf.Templates)
+
+			for _, name := range engines.Names() {
+				var engine = engines.Engines[name]
+
+				group.Go(panicsafe.Func(func() error {
+					var err = engine.Wait()
+
+					if err != nil {
+						logger.Error("engine stopped", "engine", name, "error", err.Error())
+					} else {
+						logger.Info("engine stopped", "engine", name)
+					}
 
-				if err := ch.RunStartupProbe(groupCtx, engine, conf.StartupProbe); err != nil {
 					return err
+				}))
+			}
+
+			group.Go(panicsafe.Func(func() error {
+				defer func() {
+					for _, engine := range engines.Engines {
+						engine.Stop()
+					}
+				}()
+
+				for _, name := range engines.Names() {
+					if err := ch.RunStartupProbe(slogctx.With(groupCtx, "engine", name), engines.Engines[name], conf.StartupProbe); err != nil {
+						return fmt.Errorf("engine %s: %w", name, err)
+					}
 				}
 
 				return pipeline.Run(
 					groupCtx,
-					engine,
-					tmpl,
+					engines,
+					templates,
 					vars,
 					conf.PipelineConfig,
 				)
@@ -159,3 +219,55 @@ func Command() *cli.Command {
 		},
 	}
 }
+
+// serveHTTP listens on addr before returning, so that an address already in use fails the run,
+// then serves handler in the background.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) error {
+	var logger = slogctx.FromCtx(ctx)
+
+	ln, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	go func() {
+		logger.Info("HTTP server started", "addr", ln.Addr().String())
+
+		if err := http.Serve(ln, handler); err != nil {
+			logger.Error("HTTP server stopped", "addr", addr, "error", err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// handleControlSignals toggles the pause state of the pipeline on SIGUSR1 and stops its source on SIGUSR2.
+func handleControlSignals(ctx context.Context, state *pipeline.State) {
+	var (
+		logger  = slogctx.FromCtx(ctx)
+		sigchan = make(chan os.Signal, 1)
+	)
+
+	signal.Notify(sigchan, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigchan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigchan:
+			switch {
+			case sig == syscall.SIGUSR2:
+				logger.Info("stopping source", "signal", sig.String())
+				state.StopSource()
+			case state.Paused():
+				logger.Info("resuming pipeline", "signal", sig.String())
+				state.Resume()
+			default:
+				logger.Info("pausing pipeline", "signal", sig.String())
+				state.Pause()
+			}
+		}
+	}
+}
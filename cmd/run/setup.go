@@ -0,0 +1,48 @@
+package run
+
+import (
+	"cmp"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/google/uuid"
+)
+
+// Vars returns the vars a pipeline is loaded and rendered with: AGT__VAR__ prefixed env vars,
+// overridden by the key=value pairs of the --var flags.
+func Vars(flags []string) map[string]any {
+	return utils.MergeMaps(
+		utils.ParseKeyValuesWithPrefix(os.Environ(), "=", "AGT__VAR__"),
+		utils.ParseKeyValues(flags, "="),
+	)
+}
+
+// TemplatesURL returns the URL templates are loaded from: templatePath if set, the directory
+// of the pipeline file otherwise.
+func TemplatesURL(path string, templatePath string) (*url.URL, error) {
+	u, err := url.Parse(cmp.Or(templatePath, path))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(templatePath) == 0 {
+		u.Path = filepath.Dir(u.Path)
+	}
+
+	return u, nil
+}
+
+// SetRunUUID sets the UUID var to a new UUID v7, as pipeline.Run does for a run, and returns it.
+func SetRunUUID(vars map[string]any) (string, error) {
+	runUUID, err := uuid.NewV7()
+
+	if err != nil {
+		return "", err
+	}
+
+	vars["UUID"] = runUUID.String()
+	return runUUID.String(), nil
+}
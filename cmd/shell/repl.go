@@ -0,0 +1,323 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+
+	"github.com/agnosticeng/agt/cmd/run"
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/output"
+	"github.com/agnosticeng/agt/internal/pipeline"
+	"github.com/agnosticeng/agt/internal/utils"
+)
+
+const help = `SQL statements run as is once terminated by ';' and may span several lines.
+  \render <template> [k=v...]  render a template with the shell vars and the given ones
+  \run <template> [k=v...]     render a template and run it
+  \set k=v...                  set shell vars
+  \unset k...                  unset shell vars
+  \vars                        list shell vars
+  \templates                   list templates
+  \reload                      reload templates
+  \engine [name]               show or switch the engine queries run on
+  \help                        show this help
+  \q                           quit`
+
+type shell struct {
+	ctx          context.Context
+	conf         run.Config
+	templatesURL *url.URL
+	templates    *utils.TemplateStore
+	vars         map[string]any
+	current      string
+	engines      map[string]engine.Engine
+	sessions     map[string]engine.Engine
+	stops        []func()
+	interrupts   chan os.Signal
+	out          io.Writer
+}
+
+func newShell(ctx context.Context, conf run.Config, templatesURL *url.URL, templates *utils.TemplateStore, vars map[string]any) *shell {
+	return &shell{
+		ctx:          ctx,
+		conf:         conf,
+		templatesURL: templatesURL,
+		templates:    templates,
+		vars:         vars,
+		engines:      make(map[string]engine.Engine),
+		sessions:     make(map[string]engine.Engine),
+		interrupts:   make(chan os.Signal, 1),
+		out:          os.Stdout,
+	}
+}
+
+// engine returns the named engine, or the default one if name is empty, starting it the first time it is used.
+func (sh *shell) engine(name string) (engine.Engine, error) {
+	name, err := sh.conf.EngineName(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if eng, found := sh.engines[name]; found {
+		return eng, nil
+	}
+
+	eng, stop, err := run.StartEngine(sh.ctx, sh.conf, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sh.engines[name] = eng
+	sh.stops = append(sh.stops, stop)
+	return eng, nil
+}
+
+// use switches the engine statements run on, opening the session they share the first time
+// the engine is used so that SET and temporary tables persist from one statement to the next.
+// Engines that cannot open sessions run each statement on its own.
+func (sh *shell) use(name string) error {
+	name, err := sh.conf.EngineName(name)
+
+	if err != nil {
+		return err
+	}
+
+	if _, found := sh.sessions[name]; !found {
+		eng, err := sh.engine(name)
+
+		if err != nil {
+			return err
+		}
+
+		sess, closeSession, err := pipeline.WithSession(sh.ctx, eng, engine.SessionID)
+
+		if err != nil {
+			fmt.Fprintf(sh.out, "warning: %s, session state will not persist between statements\n", err)
+			sess, closeSession = eng, func() error { return nil }
+		}
+
+		sh.sessions[name] = sess
+		sh.stops = append(sh.stops, func() { sh.report(closeSession()) })
+	}
+
+	sh.current = name
+	return nil
+}
+
+func (sh *shell) close() {
+	signal.Stop(sh.interrupts)
+
+	// sessions are closed before the engines they were opened on
+	for _, stop := range slices.Backward(sh.stops) {
+		stop()
+	}
+}
+
+// repl reads statements and commands from r until \q or the end of the input.
+func (sh *shell) repl(r io.Reader) error {
+	var (
+		scanner = bufio.NewScanner(r)
+		buf     strings.Builder
+	)
+
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	// an interrupt cancels the running query rather than the shell
+	signal.Notify(sh.interrupts, os.Interrupt)
+
+	fmt.Fprintln(sh.out, `Type \help for help.`)
+
+	for {
+		if buf.Len() == 0 {
+			fmt.Fprintf(sh.out, "%s> ", sh.current)
+		} else {
+			fmt.Fprintf(sh.out, "%s-> ", strings.Repeat(" ", len(sh.current)))
+		}
+
+		if !scanner.Scan() {
+			fmt.Fprintln(sh.out)
+
+			if buf.Len() > 0 {
+				sh.report(sh.runSQL(buf.String()))
+			}
+
+			return scanner.Err()
+		}
+
+		var line = strings.TrimSpace(scanner.Text())
+
+		if buf.Len() == 0 && strings.HasPrefix(line, `\`) {
+			if line == `\q` || line == `\quit` {
+				return nil
+			}
+
+			sh.report(sh.command(line))
+			continue
+		}
+
+		if len(line) == 0 && buf.Len() == 0 {
+			continue
+		}
+
+		buf.WriteString(scanner.Text())
+		buf.WriteString("\n")
+
+		if strings.HasSuffix(line, ";") {
+			sh.report(sh.runSQL(buf.String()))
+			buf.Reset()
+		}
+	}
+}
+
+func (sh *shell) report(err error) {
+	if err != nil {
+		fmt.Fprintf(sh.out, "error: %s\n", err)
+	}
+}
+
+func (sh *shell) command(line string) error {
+	var (
+		fields = strings.Fields(line)
+		args   = fields[1:]
+	)
+
+	switch fields[0] {
+	case `\help`, `\?`:
+		fmt.Fprintln(sh.out, help)
+
+	case `\render`, `\run`:
+		if len(args) == 0 {
+			return fmt.Errorf("%s expects a template name", fields[0])
+		}
+
+		var vars = utils.MergeMaps(sh.vars, utils.ParseKeyValues(args[1:], "="))
+
+		if fields[0] == `\render` {
+			str, err := utils.RenderTemplate(sh.templates.Load(), args[0], vars)
+
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(sh.out, str)
+			return nil
+		}
+
+		return sh.runTemplate(args[0], vars)
+
+	case `\set`:
+		maps.Copy(sh.vars, utils.ParseKeyValues(args, "="))
+
+	case `\unset`:
+		for _, k := range args {
+			delete(sh.vars, k)
+		}
+
+	case `\vars`:
+		for _, k := range slices.Sorted(maps.Keys(sh.vars)) {
+			fmt.Fprintf(sh.out, "%s = %s\n", k, output.FormatValue(sh.vars[k]))
+		}
+
+	case `\templates`:
+		var names []string
+
+		for _, tmpl := range sh.templates.Load().Templates() {
+			names = append(names, tmpl.Name())
+		}
+
+		slices.Sort(names)
+		fmt.Fprintln(sh.out, strings.Join(names, "\n"))
+
+	case `\reload`:
+		tmpl, err := utils.LoadTemplates(sh.ctx, sh.templatesURL)
+
+		if err != nil {
+			return err
+		}
+
+		sh.templates.Store(tmpl)
+
+	case `\engine`:
+		if len(args) == 0 {
+			confs, err := sh.conf.EngineConfigs()
+
+			if err != nil {
+				return err
+			}
+
+			for _, name := range slices.Sorted(maps.Keys(confs)) {
+				if name == sh.current {
+					fmt.Fprintf(sh.out, "* %s\n", name)
+				} else {
+					fmt.Fprintf(sh.out, "  %s\n", name)
+				}
+			}
+
+			return nil
+		}
+
+		return sh.use(args[0])
+
+	default:
+		return fmt.Errorf("unknown command %s, type \\help for help", fields[0])
+	}
+
+	return nil
+}
+
+func (sh *shell) runSQL(query string) error {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+
+	return sh.interruptible(func(ctx context.Context) ([]map[string]any, *engine.QueryMetadata, error) {
+		return sh.sessions[sh.current].Query(ctx, query)
+	})
+}
+
+func (sh *shell) runTemplate(name string, vars map[string]any) error {
+	return sh.interruptible(func(ctx context.Context) ([]map[string]any, *engine.QueryMetadata, error) {
+		return pipeline.RunQuery(ctx, sh.sessions[sh.current], sh.templates.Load(), ch.QueryRef{Name: name}, vars, nil, nil)
+	})
+}
+
+// interruptible runs a query that an interrupt cancels, then prints its result and metadata.
+func (sh *shell) interruptible(f func(ctx context.Context) ([]map[string]any, *engine.QueryMetadata, error)) error {
+	var ctx, cancel = context.WithCancel(sh.ctx)
+	defer cancel()
+
+	// drop interrupts received while waiting for input
+	select {
+	case <-sh.interrupts:
+	default:
+	}
+
+	go func() {
+		select {
+		case <-sh.interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	rows, md, err := f(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err := output.WriteTable(sh.out, rows, md.Columns); err != nil {
+		return err
+	}
+
+	return output.WriteMetadata(sh.out, md)
+}
@@ -0,0 +1,82 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/agnosticeng/agt/cmd/run"
+	"github.com/agnosticeng/agt/internal/pipeline"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/urfave/cli/v2"
+)
+
+var Flags = []cli.Flag{
+	&cli.StringFlag{Name: "template-path"},
+	&cli.StringSliceFlag{Name: "var"},
+	&cli.StringFlag{Name: "engine"},
+	&cli.BoolFlag{Name: "no-init"},
+}
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "shell",
+		Flags: Flags,
+		Action: func(ctx *cli.Context) error {
+			var (
+				path = ctx.Args().Get(0)
+				vars = run.Vars(ctx.StringSlice("var"))
+			)
+
+			if len(path) == 0 {
+				return fmt.Errorf("pipeline path must be specified")
+			}
+
+			conf, err := run.LoadConfig(ctx.Context, path, vars)
+
+			if err != nil {
+				return err
+			}
+
+			u, err := run.TemplatesURL(path, ctx.String("template-path"))
+
+			if err != nil {
+				return err
+			}
+
+			tmpl, err := utils.LoadTemplates(ctx.Context, u)
+
+			if err != nil {
+				return err
+			}
+
+			if _, err := run.SetRunUUID(vars); err != nil {
+				return err
+			}
+
+			var sh = newShell(ctx.Context, conf, u, utils.NewTemplateStore(tmpl), vars)
+			defer sh.close()
+
+			if err := sh.use(ctx.String("engine")); err != nil {
+				return err
+			}
+
+			if !ctx.Bool("no-init") {
+				eng, err := sh.engine(conf.Init.Engine)
+
+				if err != nil {
+					return err
+				}
+
+				initVars, err := pipeline.Init(ctx.Context, eng, sh.templates, sh.vars, conf.Init)
+
+				if err != nil {
+					return err
+				}
+
+				sh.vars = utils.MergeMaps(sh.vars, initVars)
+			}
+
+			return sh.repl(os.Stdin)
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/agnosticeng/cnf"
+	"github.com/agnosticeng/objstr"
+)
+
+// Fixture describes a pipeline test: the pipeline to run, the rows its source emits, the query results
+// to mock and what the run is expected to produce.
+type Fixture struct {
+	Name string
+	// Pipeline is the path of the pipeline file, relative to the fixture file.
+	Pipeline string
+	// Templates is the path of the templates directory, relative to the fixture file.
+	// It defaults to the directory of the pipeline file.
+	Templates string
+	Vars      map[string]any
+	// Real makes queries that are not mocked run against the engines configured in the pipeline.
+	// Otherwise they return no rows, or fail if Strict is set.
+	Real    bool
+	Strict  bool
+	Timeout time.Duration
+	// Source replaces the result of the source query: its rows are emitted once, then the source stops.
+	Source []map[string]any
+	Mocks  []fake.ResponseConfig
+	Expect ExpectConfig
+}
+
+type ExpectConfig struct {
+	// Finalized lists the vars of the finalized tasks, ordered by task ID.
+	// Only the listed keys are compared.
+	Finalized []map[string]any
+	// Error is a substring of the error the pipeline is expected to fail with.
+	Error string
+	// Snapshot compares the rendered SQL of every query to the snapshot stored next to the fixture.
+	Snapshot bool
+}
+
+func (f Fixture) WithDefaults() Fixture {
+	if f.Timeout == 0 {
+		f.Timeout = time.Minute
+	}
+
+	return f
+}
+
+func loadFixture(ctx context.Context, path string, vars map[string]any) (Fixture, error) {
+	f, err := cnf.LoadStruct[Fixture](
+		cnf.WithProvider(utils.NewCnfProvider(objstr.FromContextOrDefault(ctx), path, vars)),
+	)
+
+	if err != nil {
+		return f, err
+	}
+
+	if len(f.Name) == 0 {
+		f.Name = fixtureName(path)
+	}
+
+	return f.WithDefaults(), nil
+}
+
+func fixtureName(path string) string {
+	var base = filepath.Base(path)
+
+	for _, ext := range []string{".test.yaml", ".test.yml"} {
+		if strings.HasSuffix(base, ext) {
+			return strings.TrimSuffix(base, ext)
+		}
+	}
+
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func snapshotPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "__snapshots__", fixtureName(path)+".snap")
+}
@@ -0,0 +1,349 @@
+package test
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/agnosticeng/agt/cmd/run"
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/engine/impl"
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
+	"github.com/agnosticeng/agt/internal/pipeline"
+	"github.com/agnosticeng/agt/internal/utils"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+const snapshotSeparator = "--------------------------------------------------------------------------------"
+
+// runFixture runs the pipeline described by a fixture and returns the expectations it did not meet.
+func runFixture(ctx context.Context, path string, fixture Fixture, opts options) ([]string, error) {
+	var (
+		dir  = filepath.Dir(path)
+		vars = utils.MergeMaps(fixture.Vars, opts.vars)
+		real = fixture.Real || opts.real
+	)
+
+	if len(fixture.Pipeline) == 0 {
+		return nil, fmt.Errorf("fixture must name a pipeline")
+	}
+
+	var pipelinePath = filepath.Join(dir, fixture.Pipeline)
+
+	conf, err := run.LoadConfig(ctx, pipelinePath, vars)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pipeline: %w", err)
+	}
+
+	var templatesPath = filepath.Dir(pipelinePath)
+
+	if len(fixture.Templates) > 0 {
+		templatesPath = filepath.Join(dir, fixture.Templates)
+	}
+
+	u, err := url.Parse(templatesPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := utils.LoadTemplates(ctx, u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pipeline.ValidateTemplates(tmpl, conf.PipelineConfig); err != nil {
+		return nil, err
+	}
+
+	var responses []fake.ResponseConfig
+
+	if fixture.Source != nil {
+		responses = append(
+			responses,
+			fake.ResponseConfig{Template: conf.Source.Query.Name, Rows: fixture.Source, Times: 1},
+			fake.ResponseConfig{Template: conf.Source.Query.Name},
+		)
+	}
+
+	responses = append(responses, fixture.Mocks...)
+
+	// a test must end, so the source stops as soon as it has nothing left to emit
+	conf.Source.StopOnEmpty = true
+	conf.Source.PollInterval = 0
+
+	engines, fakes, err := newEngines(ctx, conf, real, fake.FakeEngineConfig{Responses: responses, Strict: fixture.Strict})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu        sync.Mutex
+		finalized []pipeline.Vars
+	)
+
+	var runErr = withTimeout(ctx, fixture.Timeout, func(ctx context.Context) error {
+		ctx = pipeline.WithFinalizedHandler(ctx, func(vars pipeline.Vars) {
+			mu.Lock()
+			defer mu.Unlock()
+			finalized = append(finalized, vars)
+		})
+
+		return runPipeline(ctx, engines, conf, real, utils.NewTemplateStore(tmpl), vars)
+	})
+
+	var failures []string
+
+	switch {
+	case runErr == nil && len(fixture.Expect.Error) > 0:
+		failures = append(failures, fmt.Sprintf("expected pipeline to fail with %q", fixture.Expect.Error))
+	case runErr != nil && len(fixture.Expect.Error) == 0:
+		failures = append(failures, fmt.Sprintf("pipeline failed: %s", runErr))
+	case runErr != nil && !strings.Contains(runErr.Error(), fixture.Expect.Error):
+		failures = append(failures, fmt.Sprintf("expected pipeline to fail with %q, got: %s", fixture.Expect.Error, runErr))
+	}
+
+	if fixture.Expect.Finalized != nil {
+		failures = append(failures, compareFinalized(fixture.Expect.Finalized, finalized)...)
+	}
+
+	if fixture.Expect.Snapshot {
+		failure, err := compareSnapshot(snapshotPath(path), renderSnapshot(fakes), opts.update)
+
+		if err != nil {
+			return failures, err
+		}
+
+		if len(failure) > 0 {
+			failures = append(failures, failure)
+		}
+	}
+
+	return failures, nil
+}
+
+// newEngines puts a fake engine in place of every engine of the pipeline. When real is set,
+// each fake engine falls back to the actual engine; otherwise a single fake engine serves every name.
+func newEngines(
+	ctx context.Context,
+	conf run.Config,
+	real bool,
+	fakeConf fake.FakeEngineConfig,
+) (*engine.Engines, []*fake.FakeEngine, error) {
+	confs, err := conf.EngineConfigs()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defaultName, err := impl.DefaultEngineName(confs, conf.DefaultEngine)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		names   = slices.Sorted(maps.Keys(confs))
+		engines = engine.Engines{Default: defaultName, Engines: make(map[string]engine.Engine)}
+		fakes   []*fake.FakeEngine
+	)
+
+	if !real {
+		eng, err := fake.NewFakeEngine(fakeConf)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, name := range names {
+			engines.Engines[name] = eng
+		}
+
+		return &engines, []*fake.FakeEngine{eng}, nil
+	}
+
+	realEngines, err := impl.NewEngines(ctx, confs, conf.DefaultEngine)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range realEngines.Names() {
+		eng, err := fake.NewFakeEngine(fakeConf)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		eng.SetFallback(realEngines.Engines[name])
+		engines.Engines[name] = eng
+		fakes = append(fakes, eng)
+	}
+
+	return &engines, fakes, nil
+}
+
+// runPipeline starts the engines, probes them if they are real, runs the pipeline and stops the engines.
+func runPipeline(
+	ctx context.Context,
+	engines *engine.Engines,
+	conf run.Config,
+	real bool,
+	templates *utils.TemplateStore,
+	vars map[string]any,
+) error {
+	var names = engines.Names()
+
+	for i, name := range names {
+		if err := engines.Engines[name].Start(); err != nil {
+			for _, started := range names[:i] {
+				engines.Engines[started].Stop()
+			}
+
+			return fmt.Errorf("failed to start engine %s: %w", name, err)
+		}
+	}
+
+	defer func() {
+		for _, name := range names {
+			engines.Engines[name].Stop()
+		}
+
+		for _, name := range names {
+			if err := engines.Engines[name].Wait(); err != nil {
+				slogctx.FromCtx(ctx).Error("engine stopped", "engine", name, "error", err.Error())
+			}
+		}
+	}()
+
+	if real {
+		for _, name := range names {
+			if err := ch.RunStartupProbe(slogctx.With(ctx, "engine", name), engines.Engines[name], conf.StartupProbe); err != nil {
+				return fmt.Errorf("engine %s: %w", name, err)
+			}
+		}
+	}
+
+	return pipeline.Run(ctx, engines, templates, vars, conf.PipelineConfig)
+}
+
+func compareFinalized(expected []map[string]any, actual []pipeline.Vars) []string {
+	var failures []string
+
+	slices.SortStableFunc(actual, func(a, b pipeline.Vars) int {
+		var idA, idB = pipeline.TaskFromVars(a).ID, pipeline.TaskFromVars(b).ID
+		return cmp.Or(cmp.Compare(len(idA), len(idB)), cmp.Compare(idA, idB))
+	})
+
+	if len(expected) != len(actual) {
+		failures = append(failures, fmt.Sprintf("expected %d finalized task(s), got %d", len(expected), len(actual)))
+	}
+
+	for i := range min(len(expected), len(actual)) {
+		for _, k := range slices.Sorted(maps.Keys(expected[i])) {
+			var (
+				want = normalize(expected[i][k])
+				got  = normalize(actual[i][k])
+			)
+
+			if !reflect.DeepEqual(want, got) {
+				failures = append(failures, fmt.Sprintf("finalized task %d: %s: expected %s, got %s", i, k, toJSON(want), toJSON(got)))
+			}
+		}
+	}
+
+	return failures
+}
+
+// normalize makes values that come from YAML and from ClickHouse comparable by converting them
+// to what their JSON representation decodes to.
+func normalize(v any) any {
+	js, err := json.Marshal(v)
+
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	var res any
+	json.Unmarshal(js, &res)
+	return res
+}
+
+func toJSON(v any) string {
+	js, _ := json.Marshal(v)
+	return string(js)
+}
+
+// renderSnapshot lists the SQL of every query run, grouped by template. The run UUID is replaced
+// by a placeholder so that the snapshot is stable.
+func renderSnapshot(fakes []*fake.FakeEngine) string {
+	var queries = make(map[string][]string)
+
+	for _, eng := range fakes {
+		for _, call := range eng.Calls() {
+			var (
+				query    = call.Query
+				template = cmp.Or(call.Template, "-")
+			)
+
+			if run, _ := ch.ParseQueryID(call.QueryID); len(run) > 0 {
+				query = strings.ReplaceAll(query, run, "<UUID>")
+			}
+
+			queries[template] = append(queries[template], strings.TrimSpace(query))
+		}
+	}
+
+	var sb strings.Builder
+
+	for _, template := range slices.Sorted(maps.Keys(queries)) {
+		slices.Sort(queries[template])
+
+		for _, query := range queries[template] {
+			fmt.Fprintf(&sb, "%s\n%s\n%s\n%s\n", snapshotSeparator, template, snapshotSeparator, query)
+		}
+	}
+
+	return sb.String()
+}
+
+// compareSnapshot compares actual to the snapshot stored at path, which is only written if update is set:
+// a missing snapshot is a failure, so that CI does not pass by writing it.
+func compareSnapshot(path string, actual string, update bool) (string, error) {
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+
+		return "", os.WriteFile(path, []byte(actual), 0644)
+	}
+
+	expected, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("snapshot missing: %s (run with --update to write it)", path), nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if diff := utils.Diff(path, string(expected), actual); len(diff) > 0 {
+		return "SQL snapshot mismatch (run with --update to accept):\n" + diff, nil
+	}
+
+	return "", nil
+}
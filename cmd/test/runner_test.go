@@ -0,0 +1,72 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunFixtureBufferCondition(t *testing.T) {
+	var dir = t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"pipeline.yaml": `
+Engine:
+  Fake: {}
+Source:
+  Query: source
+Stages:
+  - Buffer:
+      Queries: [insert]
+      Condition: condition
+      MaxRows: 1
+`,
+		"queries.sql": `
+{{define "source"}}SELECT 1{{end}}
+{{define "insert"}}SELECT {{.RIGHT.I}} AS K{{end}}
+{{define "condition"}}SELECT {{.K}} < 2 AS value{{end}}
+`,
+		// mocked values are decoded from YAML as plain integers, not as the *uint8 a UInt8 column is scanned into
+		"buffer.test.yaml": `
+Pipeline: pipeline.yaml
+Source: [{I: 1}, {I: 2}, {I: 3}]
+Mocks:
+  - {Template: insert, Pattern: "^SELECT 1 ", Rows: [{K: 1}], Metadata: {WroteRows: 1}}
+  - {Template: insert, Pattern: "^SELECT 2 ", Rows: [{K: 2}], Metadata: {WroteRows: 1}}
+  - {Template: insert, Pattern: "^SELECT 3 ", Rows: [{K: 3}], Metadata: {WroteRows: 1}}
+  - {Template: condition, Pattern: "^SELECT 1 ", Rows: [{value: 1}]}
+  - {Template: condition, Rows: [{value: 0}]}
+Expect:
+  Finalized: [{K: 2}, {K: 3}]
+`,
+	})
+
+	var path = filepath.Join(dir, "buffer.test.yaml")
+
+	fixture, err := loadFixture(context.Background(), path, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err := runFixture(context.Background(), path, fixture, options{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, failure := range failures {
+		t.Error(failure)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
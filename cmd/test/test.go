@@ -0,0 +1,165 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/urfave/cli/v2"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+var Flags = []cli.Flag{
+	&cli.StringSliceFlag{Name: "var"},
+	&cli.StringFlag{Name: "filter"},
+	&cli.BoolFlag{Name: "real"},
+	&cli.BoolFlag{Name: "update"},
+}
+
+type options struct {
+	vars   map[string]any
+	real   bool
+	update bool
+}
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "test",
+		Flags: Flags,
+		Action: func(ctx *cli.Context) error {
+			var (
+				opts = options{
+					vars:   utils.ParseKeyValues(ctx.StringSlice("var"), "="),
+					real:   ctx.Bool("real"),
+					update: ctx.Bool("update"),
+				}
+				filter = ctx.String("filter")
+				passed int
+				failed int
+			)
+
+			paths, err := findFixtures(ctx.Args().Slice())
+
+			if err != nil {
+				return err
+			}
+
+			if len(paths) == 0 {
+				return fmt.Errorf("no test fixture found")
+			}
+
+			for _, path := range paths {
+				fixture, err := loadFixture(ctx.Context, path, opts.vars)
+
+				if err != nil {
+					fmt.Printf("FAIL %s\n    failed to load fixture: %s\n", path, err)
+					failed++
+					continue
+				}
+
+				if len(filter) > 0 {
+					if m, _ := filepath.Match(filter, fixture.Name); !m {
+						continue
+					}
+				}
+
+				var t0 = time.Now()
+
+				failures, err := runFixture(slogctx.With(ctx.Context, "test", fixture.Name), path, fixture, opts)
+
+				if err != nil {
+					failures = append(failures, err.Error())
+				}
+
+				if len(failures) > 0 {
+					fmt.Printf("FAIL %s (%s)\n", fixture.Name, time.Since(t0).Round(time.Millisecond))
+
+					for _, failure := range failures {
+						fmt.Println(indent(failure, "    "))
+					}
+
+					failed++
+					continue
+				}
+
+				fmt.Printf("PASS %s (%s)\n", fixture.Name, time.Since(t0).Round(time.Millisecond))
+				passed++
+			}
+
+			fmt.Printf("%d passed, %d failed\n", passed, failed)
+
+			if failed > 0 {
+				return fmt.Errorf("%d test(s) failed", failed)
+			}
+
+			return nil
+		},
+	}
+}
+
+// findFixtures expands directories into the *.test.yaml and *.test.yml files they contain, recursively.
+func findFixtures(args []string) ([]string, error) {
+	var paths []string
+
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() || !(strings.HasSuffix(path, ".test.yaml") || strings.HasSuffix(path, ".test.yml")) {
+				return nil
+			}
+
+			paths = append(paths, path)
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+func indent(s string, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n"+prefix)
+}
+
+var errTimeout = errors.New("pipeline did not finish in time")
+
+// withTimeout runs f with a context cancelled after timeout, reporting errTimeout if it was.
+func withTimeout(ctx context.Context, timeout time.Duration, f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var err = f(ctx)
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errTimeout
+	}
+
+	return err
+}
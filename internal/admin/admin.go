@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/pipeline"
+)
+
+const pingTimeout = 5 * time.Second
+
+type EngineStatus struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default bool   `json:"default"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Status struct {
+	pipeline.Status
+	Engines []EngineStatus `json:"engines"`
+}
+
+// Server exposes the state of a running pipeline over HTTP.
+type Server struct {
+	engines     *engine.Engines
+	engineTypes map[string]string
+	state       *pipeline.State
+}
+
+func NewServer(engines *engine.Engines, engineTypes map[string]string, state *pipeline.State) *Server {
+	return &Server{
+		engines:     engines,
+		engineTypes: engineTypes,
+		state:       state,
+	}
+}
+
+// Register mounts the read-only admin endpoints on mux:
+//   - /status returns the pipeline state as JSON
+//   - /healthz succeeds as long as every engine answers pings
+//   - /readyz additionally requires the pipeline to be initialized
+func (srv *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /status", srv.handleStatus)
+	mux.HandleFunc("GET /healthz", srv.handleHealthz)
+	mux.HandleFunc("GET /readyz", srv.handleReadyz)
+}
+
+// RegisterControls mounts /pause, /resume and /stop-source, which control the source, on mux.
+// They are not authenticated, so mux should only be served on a trusted address.
+func (srv *Server) RegisterControls(mux *http.ServeMux) {
+	mux.HandleFunc("POST /pause", srv.handleControl(srv.state.Pause))
+	mux.HandleFunc("POST /resume", srv.handleControl(srv.state.Resume))
+	mux.HandleFunc("POST /stop-source", srv.handleControl(srv.state.StopSource))
+}
+
+func (srv *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var status = Status{Status: srv.state.Status()}
+
+	for _, name := range srv.engines.Names() {
+		var engineStatus = EngineStatus{
+			Name:    name,
+			Type:    srv.engineTypes[name],
+			Default: name == srv.engines.Default,
+		}
+
+		if err := srv.ping(r.Context(), srv.engines.Engines[name]); err != nil {
+			engineStatus.Error = err.Error()
+		} else {
+			engineStatus.Healthy = true
+		}
+
+		status.Engines = append(status.Engines, engineStatus)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (srv *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	for _, name := range srv.engines.Names() {
+		if err := srv.ping(r.Context(), srv.engines.Engines[name]); err != nil {
+			http.Error(w, fmt.Sprintf("engine %s: %s", name, err.Error()), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	if srv.state.Paused() {
+		w.Write([]byte("ok (paused)\n"))
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+func (srv *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !srv.state.Initialized() {
+		http.Error(w, "pipeline not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	srv.handleHealthz(w, r)
+}
+
+func (srv *Server) handleControl(f func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f()
+		srv.handleStatus(w, r)
+	}
+}
+
+func (srv *Server) ping(ctx context.Context, eng engine.Engine) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return eng.Ping(ctx)
+}
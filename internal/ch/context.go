@@ -0,0 +1,36 @@
+package ch
+
+import (
+	"context"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+type settingsKey struct{}
+
+type queryIDKey struct{}
+
+// WithSettings sets the settings of the queries run with ctx. They are kept readable from the context
+// for engines that do not go through clickhouse-go.
+func WithSettings(ctx context.Context, settings clickhouse.Settings) context.Context {
+	var normalized = NormalizeSettings(settings)
+
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(normalized))
+	return context.WithValue(ctx, settingsKey{}, normalized)
+}
+
+func SettingsFromContext(ctx context.Context) clickhouse.Settings {
+	settings, _ := ctx.Value(settingsKey{}).(clickhouse.Settings)
+	return settings
+}
+
+// WithQueryID sets the ID of the queries run with ctx, the same way WithSettings does.
+func WithQueryID(ctx context.Context, queryID string) context.Context {
+	ctx = clickhouse.Context(ctx, clickhouse.WithQueryID(queryID))
+	return context.WithValue(ctx, queryIDKey{}, queryID)
+}
+
+func QueryIDFromContext(ctx context.Context) string {
+	queryID, _ := ctx.Value(queryIDKey{}).(string)
+	return queryID
+}
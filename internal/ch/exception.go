@@ -0,0 +1,29 @@
+package ch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+var exceptionRegexp = regexp.MustCompile(`Code: (\d+)\. DB::Exception: ((?s).*)`)
+
+// ParseCLIException turns the error printed by a clickhouse program (local, client) into a *proto.Exception
+// when possible, err being the error the process exited with.
+func ParseCLIException(program string, stderr []byte, err error) error {
+	var msg = strings.TrimSpace(string(stderr))
+
+	if m := exceptionRegexp.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.ParseInt(m[1], 10, 32)
+		return &proto.Exception{Code: int32(code), Message: strings.TrimSpace(m[2])}
+	}
+
+	if len(msg) > 0 {
+		return fmt.Errorf("clickhouse %s failed: %w\n%s", program, err, msg)
+	}
+
+	return fmt.Errorf("clickhouse %s failed: %w", program, err)
+}
@@ -0,0 +1,65 @@
+package ch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+func TestParseCLIException(t *testing.T) {
+	var exitErr = errors.New("exit status 60")
+
+	var tests = []struct {
+		stderr  string
+		code    int32
+		message string
+		err     string
+	}{
+		{
+			stderr:  "Code: 60. DB::Exception: Unknown table expression identifier 'x'. (UNKNOWN_TABLE)\n",
+			code:    60,
+			message: "Unknown table expression identifier 'x'. (UNKNOWN_TABLE)",
+		},
+		{
+			stderr:  "Received exception from server (version 24.3.1):\nCode: 62. DB::Exception: Syntax error: failed at position 1:\n\nSELEC 1\n\n. (SYNTAX_ERROR)\n",
+			code:    62,
+			message: "Syntax error: failed at position 1:\n\nSELEC 1\n\n. (SYNTAX_ERROR)",
+		},
+		{
+			stderr: "Segmentation fault\n",
+			err:    "clickhouse local failed: exit status 60\nSegmentation fault",
+		},
+		{
+			stderr: "  \n",
+			err:    "clickhouse local failed: exit status 60",
+		},
+	}
+
+	for _, test := range tests {
+		var err = ParseCLIException("local", []byte(test.stderr), exitErr)
+
+		if len(test.err) > 0 {
+			if err.Error() != test.err {
+				t.Errorf("ParseCLIException(%q) = %q, want %q", test.stderr, err, test.err)
+			}
+
+			if !errors.Is(err, exitErr) {
+				t.Errorf("ParseCLIException(%q) should wrap the exit error", test.stderr)
+			}
+
+			continue
+		}
+
+		var exception *proto.Exception
+
+		if !errors.As(err, &exception) {
+			t.Errorf("ParseCLIException(%q) = %v, want an exception", test.stderr, err)
+			continue
+		}
+
+		if exception.Code != test.code || exception.Message != test.message {
+			t.Errorf("ParseCLIException(%q) = %d %q, want %d %q", test.stderr, exception.Code, exception.Message, test.code, test.message)
+		}
+	}
+}
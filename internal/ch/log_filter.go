@@ -0,0 +1,127 @@
+package ch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/samber/lo"
+)
+
+type LogHandlerConfig struct {
+	DiscardSources []string
+	MinLevel       string
+	IncludeSources []string
+	ExcludeSources []string
+	IncludeText    []string
+	ExcludeText    []string
+}
+
+type LogFilter struct {
+	minPriority    int8
+	discardSources []string
+	includeSources []*regexp.Regexp
+	excludeSources []*regexp.Regexp
+	includeText    []*regexp.Regexp
+	excludeText    []*regexp.Regexp
+}
+
+func NewLogFilter(conf LogHandlerConfig) (*LogFilter, error) {
+	var (
+		f   = LogFilter{minPriority: PriorityTest, discardSources: conf.DiscardSources}
+		err error
+	)
+
+	if len(conf.MinLevel) > 0 {
+		if f.minPriority, err = ParsePriority(conf.MinLevel); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.includeSources, err = compileRegexps(conf.IncludeSources); err != nil {
+		return nil, fmt.Errorf("invalid IncludeSources: %w", err)
+	}
+
+	if f.excludeSources, err = compileRegexps(conf.ExcludeSources); err != nil {
+		return nil, fmt.Errorf("invalid ExcludeSources: %w", err)
+	}
+
+	if f.includeText, err = compileRegexps(conf.IncludeText); err != nil {
+		return nil, fmt.Errorf("invalid IncludeText: %w", err)
+	}
+
+	if f.excludeText, err = compileRegexps(conf.ExcludeText); err != nil {
+		return nil, fmt.Errorf("invalid ExcludeText: %w", err)
+	}
+
+	return &f, nil
+}
+
+func (f *LogFilter) Match(l *clickhouse.Log) bool {
+	if f == nil {
+		return true
+	}
+
+	if l.Priority > f.minPriority {
+		return false
+	}
+
+	if lo.Contains(f.discardSources, l.Source) {
+		return false
+	}
+
+	if len(f.includeSources) > 0 && !matchAny(f.includeSources, l.Source) {
+		return false
+	}
+
+	if matchAny(f.excludeSources, l.Source) {
+		return false
+	}
+
+	if len(f.includeText) > 0 && !matchAny(f.includeText, l.Text) {
+		return false
+	}
+
+	if matchAny(f.excludeText, l.Text) {
+		return false
+	}
+
+	return true
+}
+
+func ParsePriority(s string) (int8, error) {
+	for name, p := range priorityNames {
+		if strings.EqualFold(name, s) {
+			return p, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown log level: %s", s)
+}
+
+func compileRegexps(exprs []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+
+	for _, expr := range exprs {
+		r, err := regexp.Compile(expr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+func matchAny(rs []*regexp.Regexp, s string) bool {
+	for _, r := range rs {
+		if r.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+package ch
+
+import (
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func TestLogFilter(t *testing.T) {
+	var (
+		info  = &clickhouse.Log{Priority: PriorityInformation, Source: "executeQuery", Text: "Read 10 rows"}
+		debug = &clickhouse.Log{Priority: PriorityDebug, Source: "MemoryTracker", Text: "Peak memory usage: 1 MiB"}
+		err   = &clickhouse.Log{Priority: PriorityError, Source: "TCPHandler", Text: "Code: 60. DB::Exception"}
+	)
+
+	var tests = []struct {
+		name string
+		conf LogHandlerConfig
+		// want tells whether info, debug and err match
+		want [3]bool
+	}{
+		{"default", LogHandlerConfig{}, [3]bool{true, true, true}},
+		{"min level", LogHandlerConfig{MinLevel: "information"}, [3]bool{true, false, true}},
+		{"min level error", LogHandlerConfig{MinLevel: "Error"}, [3]bool{false, false, true}},
+		{"discard sources", LogHandlerConfig{DiscardSources: []string{"MemoryTracker"}}, [3]bool{true, false, true}},
+		{"discard sources is exact", LogHandlerConfig{DiscardSources: []string{"Memory"}}, [3]bool{true, true, true}},
+		{"include sources", LogHandlerConfig{IncludeSources: []string{"^execute", "Handler$"}}, [3]bool{true, false, true}},
+		{"exclude sources", LogHandlerConfig{ExcludeSources: []string{"Handler"}}, [3]bool{true, true, false}},
+		{"include text", LogHandlerConfig{IncludeText: []string{`\d+ rows`}}, [3]bool{true, false, false}},
+		{"exclude text", LogHandlerConfig{ExcludeText: []string{"(?i)memory"}}, [3]bool{true, false, true}},
+		{
+			"exclude wins over include",
+			LogHandlerConfig{IncludeSources: []string{".*"}, ExcludeText: []string{"Exception"}},
+			[3]bool{true, true, false},
+		},
+		{
+			"all criteria",
+			LogHandlerConfig{MinLevel: "debug", IncludeSources: []string{"Query|Tracker"}, ExcludeText: []string{"Peak"}},
+			[3]bool{true, false, false},
+		},
+	}
+
+	for _, test := range tests {
+		f, e := NewLogFilter(test.conf)
+
+		if e != nil {
+			t.Errorf("%s: %v", test.name, e)
+			continue
+		}
+
+		for i, l := range []*clickhouse.Log{info, debug, err} {
+			if got := f.Match(l); got != test.want[i] {
+				t.Errorf("%s: Match(%s: %s) = %t, want %t", test.name, l.Source, l.Text, got, test.want[i])
+			}
+		}
+	}
+
+	var nilFilter *LogFilter
+
+	if !nilFilter.Match(info) {
+		t.Errorf("a nil filter should match everything")
+	}
+}
+
+func TestNewLogFilterErrors(t *testing.T) {
+	var tests = []LogHandlerConfig{
+		{MinLevel: "verbose"},
+		{IncludeSources: []string{"("}},
+		{ExcludeSources: []string{"["}},
+		{IncludeText: []string{"*"}},
+		{ExcludeText: []string{"(?z)"}},
+	}
+
+	for _, conf := range tests {
+		if _, err := NewLogFilter(conf); err == nil {
+			t.Errorf("NewLogFilter(%+v) should fail", conf)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package ch
 
 import (
+	"context"
 	"log/slog"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -9,10 +10,6 @@ import (
 	"github.com/samber/lo"
 )
 
-type LogHandlerConfig struct {
-	DiscardSources []string
-}
-
 func ProgressHandler(md *engine.QueryMetadata) func(*proto.Progress) {
 	return func(p *proto.Progress) {
 		if p == nil {
@@ -28,13 +25,15 @@ func ProgressHandler(md *engine.QueryMetadata) func(*proto.Progress) {
 	}
 }
 
-func LogHandler(logger *slog.Logger, conf LogHandlerConfig) func(*clickhouse.Log) {
+func LogHandler(logger *slog.Logger, filter *LogFilter) func(*clickhouse.Log) {
 	return func(l *clickhouse.Log) {
-		if lo.Contains(conf.DiscardSources, l.Source) {
+		if !filter.Match(l) {
 			return
 		}
 
-		logger.Info(
+		logger.Log(
+			context.Background(),
+			PriorityToLevel(l.Priority),
 			l.Text,
 			"hostname", l.Hostname,
 			"query_id", l.QueryID,
@@ -45,12 +44,43 @@ func LogHandler(logger *slog.Logger, conf LogHandlerConfig) func(*clickhouse.Log
 	}
 }
 
-func ProfileEventHandler(md *engine.QueryMetadata) func([]clickhouse.ProfileEvent) {
+var DefaultProfileEvents = []string{
+	"S3ReadRequestsCount",
+	"S3WriteRequestsCount",
+	"S3GetObject",
+	"S3PutObject",
+	"S3ListObjects",
+	"S3HeadObject",
+	"ReadBufferFromS3Bytes",
+	"WriteBufferFromS3Bytes",
+	"SelectedParts",
+	"SelectedRanges",
+	"SelectedMarks",
+	"SelectedRows",
+	"SelectedBytes",
+	"OSCPUVirtualTimeMicroseconds",
+	"OSCPUWaitMicroseconds",
+	"UserTimeMicroseconds",
+	"SystemTimeMicroseconds",
+}
+
+func ProfileEventHandler(md *engine.QueryMetadata, names []string) func([]clickhouse.ProfileEvent) {
 	return func(events []clickhouse.ProfileEvent) {
 		for _, p := range events {
 			if p.Name == "MemoryTrackerPeakUsage" {
 				md.MemoryPeakUsage = max(md.MemoryPeakUsage, uint64(p.Value))
+				continue
 			}
+
+			if p.Type != "increment" || p.Value <= 0 || !lo.Contains(names, p.Name) {
+				continue
+			}
+
+			if md.ProfileEvents == nil {
+				md.ProfileEvents = make(map[string]uint64)
+			}
+
+			md.ProfileEvents[p.Name] += uint64(p.Value)
 		}
 	}
 }
@@ -15,6 +15,7 @@ type QueryMetrics struct {
 	WroteRows       tally.Counter
 	WroteBytes      tally.Counter
 	MemoryPeakUsage tally.Gauge
+	profileEvents   tally.Scope
 }
 
 func NewQueryMetrics(scope tally.Scope) *QueryMetrics {
@@ -33,5 +34,10 @@ func NewQueryMetrics(scope tally.Scope) *QueryMetrics {
 		WroteRows:       scope.Counter("wrote_rows"),
 		WroteBytes:      scope.Counter("wrote_bytes"),
 		MemoryPeakUsage: scope.Gauge("memory_peak_usage"),
+		profileEvents:   scope,
 	}
 }
+
+func (m *QueryMetrics) ProfileEvent(name string) tally.Counter {
+	return m.profileEvents.Tagged(map[string]string{"event": name}).Counter("profile_events")
+}
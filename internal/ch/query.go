@@ -5,11 +5,11 @@ import (
 	"strings"
 
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
 )
 
 func IsDataQuery(query string) bool {
-	query = strings.ToUpper(query)
-	query = strings.TrimLeft(query, " ")
+	query = strings.ToUpper(stripLeadingComments(query))
 
 	switch {
 	case strings.HasPrefix(query, "SELECT"):
@@ -21,6 +21,28 @@ func IsDataQuery(query string) bool {
 	}
 }
 
+func stripLeadingComments(query string) string {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n")
+
+		switch {
+		case strings.HasPrefix(query, "/*"):
+			_, rest, found := strings.Cut(query, "*/")
+
+			if !found {
+				return ""
+			}
+
+			query = rest
+		case strings.HasPrefix(query, "--"):
+			_, rest, _ := strings.Cut(query, "\n")
+			query = rest
+		default:
+			return query
+		}
+	}
+}
+
 func RowsToMaps(rows driver.Rows) ([]map[string]interface{}, error) {
 	var (
 		columnNames = rows.Columns()
@@ -59,3 +81,36 @@ func RowsToMaps(rows driver.Rows) ([]map[string]interface{}, error) {
 
 	return res, nil
 }
+
+// BlockToMaps is the counterpart of RowsToMaps for a decoded Native format block,
+// scanning values into the same types as the native protocol does.
+func BlockToMaps(block *proto.Block) ([]map[string]interface{}, error) {
+	var (
+		columnNames = block.ColumnsNames()
+		res         []map[string]any
+	)
+
+	for row := 0; row < block.Rows(); row++ {
+		var item = make(map[string]any)
+
+		for i, col := range block.Columns {
+			if strings.HasPrefix(columnNames[i], "_") {
+				continue
+			}
+
+			var v = reflect.New(col.ScanType()).Interface()
+
+			if err := col.ScanRow(v, row); err != nil {
+				return nil, err
+			}
+
+			item[columnNames[i]] = v
+		}
+
+		if len(item) > 0 {
+			res = append(res, item)
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,23 @@
+package ch
+
+import "strings"
+
+// ParseQueryID splits a query ID built by the pipeline (agt:<run>:<stage>:<task>:<template>)
+// into its run and template parts, which are empty if missing or if the ID has another form.
+func ParseQueryID(queryID string) (run string, template string) {
+	var parts = strings.SplitN(queryID, ":", 5)
+
+	if len(parts) != 5 || parts[0] != "agt" {
+		return "", ""
+	}
+
+	if parts[1] != "-" {
+		run = parts[1]
+	}
+
+	if parts[4] != "-" {
+		template = parts[4]
+	}
+
+	return run, template
+}
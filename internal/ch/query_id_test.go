@@ -0,0 +1,29 @@
+package ch
+
+import "testing"
+
+func TestParseQueryID(t *testing.T) {
+	var tests = []struct {
+		queryID  string
+		run      string
+		template string
+	}{
+		{"agt:0190d1a4-7b6c:stage 0:12:insert.sql", "0190d1a4-7b6c", "insert.sql"},
+		{"agt:run:-:-:source", "run", "source"},
+		{"agt:-:-:-:<query>", "", "<query>"},
+		{"agt:run:init:-:-", "run", ""},
+		{"agt:run:0:1:a:b", "run", "a:b"},
+		{"agt:run:0:1", "", ""},
+		{"other:run:0:1:a", "", ""},
+		{"0190d1a4-7b6c-7f00-8000-000000000001", "", ""},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		run, template := ParseQueryID(test.queryID)
+
+		if run != test.run || template != test.template {
+			t.Errorf("ParseQueryID(%q) = %q, %q, want %q, %q", test.queryID, run, template, test.run, test.template)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package ch
+
+import (
+	"log/slog"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/engine"
+)
+
+// ClickHouse log priorities, as defined by Poco::Message::Priority.
+const (
+	PriorityFatal       int8 = 1
+	PriorityCritical    int8 = 2
+	PriorityError       int8 = 3
+	PriorityWarning     int8 = 4
+	PriorityNotice      int8 = 5
+	PriorityInformation int8 = 6
+	PriorityDebug       int8 = 7
+	PriorityTrace       int8 = 8
+	PriorityTest        int8 = 9
+)
+
+const (
+	LevelTrace = slog.LevelDebug - 4
+	LevelFatal = slog.LevelError + 4
+)
+
+var (
+	priorityNames = map[string]int8{
+		"Fatal":       PriorityFatal,
+		"Critical":    PriorityCritical,
+		"Error":       PriorityError,
+		"Warning":     PriorityWarning,
+		"Notice":      PriorityNotice,
+		"Information": PriorityInformation,
+		"Debug":       PriorityDebug,
+		"Trace":       PriorityTrace,
+		"Test":        PriorityTest,
+	}
+
+	// 2024.01.01 12:00:00.123456 [ 1234 ] {query_id} <Information> Application: Starting ClickHouse
+	serverLogLineRegexp = regexp.MustCompile(`^(\d{4}\.\d{2}\.\d{2} \d{2}:\d{2}:\d{2}\.\d+) \[ (\d+) \] \{([^}]*)\} <(\w+)> ([^:]+): (.*)$`)
+)
+
+const serverLogTimeLayout = "2006.01.02 15:04:05.999999"
+
+func PriorityFromName(name string) (int8, bool) {
+	p, found := priorityNames[name]
+	return p, found
+}
+
+func PriorityToLevel(priority int8) slog.Level {
+	switch {
+	case priority <= PriorityCritical:
+		return LevelFatal
+	case priority == PriorityError:
+		return slog.LevelError
+	case priority == PriorityWarning:
+		return slog.LevelWarn
+	case priority <= PriorityInformation:
+		return slog.LevelInfo
+	case priority == PriorityDebug:
+		return slog.LevelDebug
+	default:
+		return LevelTrace
+	}
+}
+
+// ParseServerLogLine parses a line written by clickhouse-server to its log files or console.
+// It returns false for lines that do not start a new log entry, such as stack trace continuations.
+func ParseServerLogLine(line string) (*engine.Log, bool) {
+	var m = serverLogLineRegexp.FindStringSubmatch(line)
+
+	if m == nil {
+		return nil, false
+	}
+
+	priority, found := PriorityFromName(m[4])
+
+	if !found {
+		return nil, false
+	}
+
+	var l = engine.Log{
+		QueryID:  m[3],
+		Priority: priority,
+		Source:   m[5],
+		Text:     m[6],
+	}
+
+	if t, err := time.ParseInLocation(serverLogTimeLayout, m[1], time.Local); err == nil {
+		l.Time = t
+	}
+
+	if id, err := strconv.ParseUint(m[2], 10, 64); err == nil {
+		l.ThreadID = id
+	}
+
+	return &l, true
+}
@@ -0,0 +1,91 @@
+package ch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/engine"
+)
+
+func TestParseServerLogLine(t *testing.T) {
+	var tests = []struct {
+		line string
+		want *engine.Log
+	}{
+		{
+			line: "2024.01.02 12:34:56.123456 [ 1234 ] {abc:def} <Information> Application: Starting ClickHouse",
+			want: &engine.Log{
+				Time:     time.Date(2024, 1, 2, 12, 34, 56, 123456000, time.Local),
+				QueryID:  "abc:def",
+				ThreadID: 1234,
+				Priority: PriorityInformation,
+				Source:   "Application",
+				Text:     "Starting ClickHouse",
+			},
+		},
+		{
+			line: "2024.01.02 12:34:56.1 [ 7 ] {} <Error> executeQuery: Code: 60. DB::Exception: Table x doesn't exist: while executing",
+			want: &engine.Log{
+				Time:     time.Date(2024, 1, 2, 12, 34, 56, 100000000, time.Local),
+				ThreadID: 7,
+				Priority: PriorityError,
+				Source:   "executeQuery",
+				Text:     "Code: 60. DB::Exception: Table x doesn't exist: while executing",
+			},
+		},
+		{line: "0. DB::Exception::Exception() @ 0x000000000c6e3f3b"},
+		{line: "2024.01.02 12:34:56.123456 [ 1234 ] {} <Verbose> Application: unknown priority"},
+		{line: ""},
+	}
+
+	for _, test := range tests {
+		got, ok := ParseServerLogLine(test.line)
+
+		if test.want == nil {
+			if ok {
+				t.Errorf("ParseServerLogLine(%q) = %+v, want no log", test.line, got)
+			}
+
+			continue
+		}
+
+		if !ok {
+			t.Errorf("ParseServerLogLine(%q) returned no log", test.line)
+			continue
+		}
+
+		if *got != *test.want {
+			t.Errorf("ParseServerLogLine(%q) = %+v, want %+v", test.line, *got, *test.want)
+		}
+	}
+}
+
+func TestPriorityToLevel(t *testing.T) {
+	var tests = []struct {
+		name string
+		want string
+	}{
+		{"Fatal", "ERROR+4"},
+		{"Critical", "ERROR+4"},
+		{"Error", "ERROR"},
+		{"Warning", "WARN"},
+		{"Notice", "INFO"},
+		{"Information", "INFO"},
+		{"Debug", "DEBUG"},
+		{"Trace", "DEBUG-4"},
+		{"Test", "DEBUG-4"},
+	}
+
+	for _, test := range tests {
+		p, found := PriorityFromName(test.name)
+
+		if !found {
+			t.Errorf("PriorityFromName(%q) not found", test.name)
+			continue
+		}
+
+		if got := PriorityToLevel(p).String(); got != test.want {
+			t.Errorf("PriorityToLevel(%s) = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package ch
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/google/uuid"
+)
+
+// OpenSessionConn opens a pool limited to a single connection, so that every query sent through it
+// runs in the same ClickHouse session. In SESSION_ID mode the session is also given a unique session_id,
+// which requires the HTTP protocol.
+// The driver has no way of lending one connection of an existing pool, hence the new pool (and connection)
+// per session.
+func OpenSessionConn(opts clickhouse.Options, mode engine.SessionMode) (driver.Conn, error) {
+	opts.MaxOpenConns = 1
+	opts.MaxIdleConns = 1
+	opts.Settings = maps.Clone(opts.Settings)
+
+	if mode == engine.SessionID {
+		if opts.Protocol != clickhouse.HTTP {
+			return nil, fmt.Errorf("session_id requires the HTTP protocol")
+		}
+
+		if opts.Settings == nil {
+			opts.Settings = make(clickhouse.Settings)
+		}
+
+		opts.Settings["session_id"] = "agt-" + uuid.NewString()
+	}
+
+	return clickhouse.Open(&opts)
+}
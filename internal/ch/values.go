@@ -0,0 +1,114 @@
+package ch
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// ToFloat64 coerces a value scanned from a ClickHouse numeric column (any integer, float or decimal type,
+// possibly behind pointers for Nullable columns) to a float64.
+func ToFloat64(v any) (float64, error) {
+	rv, err := derefValue(v)
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+
+		return 0, nil
+	}
+
+	switch x := rv.Addr().Interface().(type) {
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(x).Float64()
+		return f, nil
+	case interface{ InexactFloat64() float64 }:
+		return x.InexactFloat64(), nil
+	default:
+		return 0, fmt.Errorf("cannot convert value of type %s to a number", rv.Type())
+	}
+}
+
+// ToInt64 is like ToFloat64 but keeps full precision for integer types that fit in an int64.
+func ToInt64(v any) (int64, error) {
+	rv, err := derefValue(v)
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int64", rv.Uint())
+		}
+
+		return int64(rv.Uint()), nil
+	}
+
+	f, err := ToFloat64(v)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if f > math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("value %f overflows int64", f)
+	}
+
+	return int64(math.Round(f)), nil
+}
+
+// ToString renders a scanned value for use as a metric tag or label.
+func ToString(v any) (string, error) {
+	rv, err := derefValue(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	if s, ok := rv.Addr().Interface().(fmt.Stringer); ok {
+		return s.String(), nil
+	}
+
+	return fmt.Sprint(rv.Interface()), nil
+}
+
+func derefValue(v any) (reflect.Value, error) {
+	var rv = reflect.ValueOf(v)
+
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("value is null")
+		}
+
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() {
+		return reflect.Value{}, fmt.Errorf("value is null")
+	}
+
+	if !rv.CanAddr() {
+		var addressable = reflect.New(rv.Type()).Elem()
+		addressable.Set(rv)
+		rv = addressable
+	}
+
+	return rv, nil
+}
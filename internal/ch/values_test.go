@@ -0,0 +1,128 @@
+package ch
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// values as the driver scans them: Nullable columns behind pointers, Decimal and (U)Int128/256 as structs
+var (
+	nilUint8   *uint8
+	uint8Value = uint8(7)
+	int64Value = int64(-3)
+	int64Ptr   = &int64Value
+	bigInt     = big.NewInt(1 << 40)
+	hugeInt, _ = new(big.Int).SetString("170141183460469231731687303715884105727", 10)
+	dec        = decimal.RequireFromString("12.75")
+	str        = "abc"
+)
+
+func TestToFloat64(t *testing.T) {
+	var tests = []struct {
+		name    string
+		v       any
+		want    float64
+		wantErr bool
+	}{
+		{"int", 3, 3, false},
+		{"negative int64", int64(-3), -3, false},
+		{"uint8 pointer", &uint8Value, 7, false},
+		{"pointer to pointer", &int64Ptr, -3, false},
+		{"float32", float32(1.5), 1.5, false},
+		{"bool", true, 1, false},
+		{"big int", bigInt, 1 << 40, false},
+		{"big int value", *bigInt, 1 << 40, false},
+		{"huge int", hugeInt, 1.7014118346046923e38, false},
+		{"decimal", dec, 12.75, false},
+		{"decimal pointer", &dec, 12.75, false},
+		{"nil", nil, 0, true},
+		{"nil pointer", nilUint8, 0, true},
+		{"string", str, 0, true},
+		{"time", time.Unix(0, 0), 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ToFloat64(test.v)
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: ToFloat64() error = %v, want error %t", test.name, err, test.wantErr)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: ToFloat64() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestToInt64(t *testing.T) {
+	var tests = []struct {
+		name    string
+		v       any
+		want    int64
+		wantErr bool
+	}{
+		{"int", 3, 3, false},
+		{"uint8 pointer", &uint8Value, 7, false},
+		{"pointer to pointer", &int64Ptr, -3, false},
+		{"max int64", int64(math.MaxInt64), math.MaxInt64, false},
+		{"max uint64", uint64(math.MaxUint64), 0, true},
+		{"float rounded", 2.5, 3, false},
+		{"bool", false, 0, false},
+		{"big int", bigInt, 1 << 40, false},
+		{"huge int", hugeInt, 0, true},
+		{"decimal", dec, 13, false},
+		{"nil", nil, 0, true},
+		{"nil pointer", nilUint8, 0, true},
+		{"string", str, 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ToInt64(test.v)
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: ToInt64() error = %v, want error %t", test.name, err, test.wantErr)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: ToInt64() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestToString(t *testing.T) {
+	var tests = []struct {
+		name    string
+		v       any
+		want    string
+		wantErr bool
+	}{
+		{"string", str, "abc", false},
+		{"string pointer", &str, "abc", false},
+		{"int", 3, "3", false},
+		{"uint8 pointer", &uint8Value, "7", false},
+		{"huge int", hugeInt, "170141183460469231731687303715884105727", false},
+		{"decimal", dec, "12.75", false},
+		{"decimal pointer", &dec, "12.75", false},
+		{"nil", nil, "", true},
+		{"nil pointer", nilUint8, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := ToString(test.v)
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: ToString() error = %v, want error %t", test.name, err, test.wantErr)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: ToString() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package engine
+
+import "context"
+
+type affinityKey struct{}
+
+// WithAffinity tags ctx with a key identifying a unit of work, typically a pipeline task,
+// whose queries should be served by the same backend when the engine can tell backends apart.
+func WithAffinity(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, affinityKey{}, key)
+}
+
+func AffinityFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(affinityKey{}).(string)
+	return key
+}
@@ -21,6 +21,9 @@ type QueryMetadata struct {
 	WroteBytes      uint64
 	Elapsed         time.Duration
 	MemoryPeakUsage uint64
+	ProfileEvents   map[string]uint64
+	// Columns are the column names of the result in query order, since rows do not keep it.
+	Columns []string
 }
 
 func (md *QueryMetadata) Merge(other *QueryMetadata) {
@@ -31,6 +34,18 @@ func (md *QueryMetadata) Merge(other *QueryMetadata) {
 	md.WroteBytes += other.WroteBytes
 	md.Elapsed += other.Elapsed
 	md.MemoryPeakUsage = max(md.MemoryPeakUsage, other.MemoryPeakUsage)
+
+	if other.Columns != nil {
+		md.Columns = other.Columns
+	}
+
+	for k, v := range other.ProfileEvents {
+		if md.ProfileEvents == nil {
+			md.ProfileEvents = make(map[string]uint64)
+		}
+
+		md.ProfileEvents[k] += v
+	}
 }
 
 type Log struct {
@@ -0,0 +1,32 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Engines is a set of named engines. Pipeline components pick one by name and fall back to the default one.
+type Engines struct {
+	Default string
+	Engines map[string]Engine
+}
+
+func (engines *Engines) Get(name string) (Engine, error) {
+	if len(name) == 0 {
+		name = engines.Default
+	}
+
+	eng, found := engines.Engines[name]
+
+	if !found {
+		return nil, fmt.Errorf("unknown engine: %s", name)
+	}
+
+	return eng, nil
+}
+
+// Names returns the names of the engines, sorted.
+func (engines *Engines) Names() []string {
+	return slices.Sorted(maps.Keys(engines.Engines))
+}
@@ -0,0 +1,349 @@
+package chlocal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	chproto "github.com/ClickHouse/ch-go/proto"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/engine/impl/local"
+	"github.com/iancoleman/strcase"
+	slogctx "github.com/veqryn/slog-context"
+	"gopkg.in/yaml.v3"
+)
+
+type ClickhouseLocalEngineConfig struct {
+	BinaryPath string
+	// Path is the data directory of clickhouse local. Tables created with a persistent engine
+	// (e.g. MergeTree) survive across queries and runs as long as the same path is used.
+	// When empty, a temporary directory is used and removed on exit unless DisableCleanup is set.
+	Path           string
+	Env            map[string]string
+	Bundles        []string
+	BundlesPath    string
+	DisableCleanup bool
+	ServerSettings map[string]any
+	Settings       map[string]any
+	Vars           map[string]any
+}
+
+// ClickhouseLocalEngine runs every query in its own clickhouse local process, so no server nor port is needed.
+// Processes share the same data path, which is what makes state outlive a single query;
+// temporary tables and session settings do not.
+// clickhouse local locks its data path, so queries are serialized: a query waits for the previous ones to finish,
+// whatever the PoolSize of the stage or the number of stages using the engine.
+// Only the elapsed time of the query metadata is filled, and it does not include the time spent waiting.
+type ClickhouseLocalEngine struct {
+	conf      ClickhouseLocalEngineConfig
+	logger    *slog.Logger
+	temporary bool
+	lock      chan struct{}
+	queries   atomic.Int32
+	failure   atomic.Pointer[error]
+	wg        sync.WaitGroup
+	stopCtx   context.Context
+	stop      context.CancelFunc
+}
+
+func NewClickhouseLocalEngine(ctx context.Context, conf ClickhouseLocalEngineConfig) (*ClickhouseLocalEngine, error) {
+	var (
+		logger    = slogctx.FromCtx(ctx)
+		temporary bool
+	)
+
+	if len(conf.BinaryPath) == 0 {
+		conf.BinaryPath = "clickhouse"
+	}
+
+	if len(conf.BundlesPath) == 0 {
+		path, err := local.DefaultBundlesPath()
+
+		if err != nil {
+			return nil, err
+		}
+
+		conf.BundlesPath = path
+	}
+
+	// vars are also made available under their screaming snake case name, without modifying the caller's map
+	var vars = maps.Clone(conf.Vars)
+
+	for k, v := range conf.Vars {
+		vars[strcase.ToScreamingSnake(k)] = v
+	}
+
+	conf.Vars = vars
+
+	if !filepath.IsAbs(conf.BinaryPath) {
+		path, err := exec.LookPath(conf.BinaryPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		conf.BinaryPath = path
+	}
+
+	if len(conf.Path) == 0 {
+		p, err := os.MkdirTemp(os.TempDir(), "*")
+
+		if err != nil {
+			return nil, err
+		}
+
+		conf.Path = p
+		temporary = true
+		logger.Debug("created temporary data path", "path", conf.Path)
+	} else {
+		p, err := filepath.Abs(conf.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.MkdirAll(p, 0700); err != nil {
+			return nil, err
+		}
+
+		conf.Path = p
+	}
+
+	var finalSettings = make(map[string]any)
+	maps.Copy(finalSettings, generateDefaultSettings(conf.Path))
+	maps.Copy(finalSettings, ch.NormalizeSettings(conf.ServerSettings))
+
+	data, err := yaml.Marshal(finalSettings)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(conf.Path, "config.yaml"), data, 0644); err != nil {
+		return nil, err
+	}
+
+	if err := local.InstallBundles(ctx, conf.Bundles, conf.BundlesPath, conf.Vars, conf.Path); err != nil {
+		return nil, err
+	}
+
+	stopCtx, stop := context.WithCancel(context.Background())
+
+	return &ClickhouseLocalEngine{
+		conf:      conf,
+		logger:    logger,
+		temporary: temporary,
+		lock:      make(chan struct{}, 1),
+		stopCtx:   stopCtx,
+		stop:      stop,
+	}, nil
+}
+
+func (eng *ClickhouseLocalEngine) Start() error {
+	return nil
+}
+
+// Stop kills the queries still running.
+func (eng *ClickhouseLocalEngine) Stop() {
+	eng.stop()
+}
+
+func (eng *ClickhouseLocalEngine) Wait() error {
+	<-eng.stopCtx.Done()
+	eng.wg.Wait()
+
+	if eng.temporary && !eng.conf.DisableCleanup {
+		os.RemoveAll(eng.conf.Path)
+	}
+
+	return nil
+}
+
+// Ping runs a trivial query, unless queries are already running or waiting: Ping would only queue behind them,
+// so it reports the outcome of the last process instead. A process that returned a ClickHouse exception
+// still shows that the binary works.
+func (eng *ClickhouseLocalEngine) Ping(ctx context.Context) error {
+	if eng.queries.Load() > 0 {
+		if failure := eng.failure.Load(); failure != nil {
+			return *failure
+		}
+
+		return nil
+	}
+
+	_, _, err := eng.Query(ctx, "SELECT 1")
+	return err
+}
+
+func (eng *ClickhouseLocalEngine) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	if len(args) > 0 {
+		return nil, &engine.QueryMetadata{}, fmt.Errorf("query arguments are not supported by the clickhouse-local engine")
+	}
+
+	var stdout bytes.Buffer
+
+	md, err := eng.run(ctx, query, "Native", &stdout)
+
+	if err != nil {
+		return nil, md, err
+	}
+
+	var (
+		reader = chproto.NewReader(&stdout)
+		res    []map[string]any
+	)
+
+	for {
+		var block proto.Block
+
+		if err := block.Decode(reader, 0); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, md, err
+		}
+
+		if md.Columns == nil {
+			md.Columns = block.ColumnsNames()
+		}
+
+		rows, err := ch.BlockToMaps(&block)
+
+		if err != nil {
+			return nil, md, err
+		}
+
+		res = append(res, rows...)
+	}
+
+	return res, md, nil
+}
+
+// QueryStream writes the output of clickhouse local, in the given format, to w.
+func (eng *ClickhouseLocalEngine) QueryStream(ctx context.Context, query string, format string, w io.Writer) (*engine.QueryMetadata, error) {
+	return eng.run(ctx, query, format, w)
+}
+
+// run runs a query in a new clickhouse local process writing its output to stdout, once the processes
+// started before it have exited.
+func (eng *ClickhouseLocalEngine) run(ctx context.Context, query string, format string, stdout io.Writer) (*engine.QueryMetadata, error) {
+	var md = engine.QueryMetadata{}
+
+	if eng.stopCtx.Err() != nil {
+		return &md, fmt.Errorf("clickhouse-local engine is stopped")
+	}
+
+	eng.wg.Add(1)
+	defer eng.wg.Done()
+
+	eng.queries.Add(1)
+	defer eng.queries.Add(-1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(eng.stopCtx, cancel)()
+
+	select {
+	case eng.lock <- struct{}{}:
+		defer func() { <-eng.lock }()
+	case <-ctx.Done():
+		return &md, ctx.Err()
+	}
+
+	var (
+		t0     = time.Now()
+		stderr bytes.Buffer
+		cmd    = exec.CommandContext(ctx, eng.conf.BinaryPath, eng.args(ctx, format)...)
+	)
+
+	cmd.Dir = eng.conf.Path
+	cmd.Env = slices.Clone(os.Environ())
+	cmd.Stdin = strings.NewReader(query)
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	for k, v := range eng.conf.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", strcase.ToScreamingSnake(k), v))
+	}
+
+	var err = cmd.Run()
+	md.Elapsed = time.Since(t0)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return &md, ctx.Err()
+		}
+
+		err = ch.ParseCLIException("local", stderr.Bytes(), err)
+		eng.setOutcome(err)
+		return &md, err
+	}
+
+	eng.setOutcome(nil)
+
+	if stderr.Len() > 0 {
+		slogctx.FromCtx(ctx).Debug("clickhouse local output", "stderr", strings.TrimSpace(stderr.String()))
+	}
+
+	return &md, nil
+}
+
+// setOutcome records the error of the last process for Ping, unless it is a ClickHouse exception.
+func (eng *ClickhouseLocalEngine) setOutcome(err error) {
+	var exception *proto.Exception
+
+	if err == nil || errors.As(err, &exception) {
+		eng.failure.Store(nil)
+		return
+	}
+
+	eng.failure.Store(&err)
+}
+
+func (eng *ClickhouseLocalEngine) args(ctx context.Context, format string) []string {
+	var res = []string{
+		"local",
+		"--config-file=config.yaml",
+		"--path=" + eng.conf.Path,
+		"--output-format=" + format,
+		"--multiquery",
+	}
+
+	var settings = make(map[string]any)
+	maps.Copy(settings, ch.NormalizeSettings(eng.conf.Settings))
+	maps.Copy(settings, ch.SettingsFromContext(ctx))
+
+	for _, k := range slices.Sorted(maps.Keys(settings)) {
+		res = append(res, fmt.Sprintf("--%s=%v", k, settings[k]))
+	}
+
+	if queryID := ch.QueryIDFromContext(ctx); len(queryID) > 0 {
+		res = append(res, "--query_id="+queryID)
+	}
+
+	return res
+}
+
+func generateDefaultSettings(path string) map[string]any {
+	return map[string]any{
+		"path": path + "/",
+		"user_defined_executable_functions_config": filepath.Join(path, "*_function.*ml"),
+		"user_scripts_path":                        filepath.Join(path, "user_scripts") + "/",
+		"user_defined_path":                        filepath.Join(path, "user_defined") + "/",
+	}
+}
@@ -0,0 +1,165 @@
+package chlocal
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClickhouse stands for the clickhouse binary: like clickhouse local, it locks <path>/status
+// and fails if another process holds the lock.
+const fakeClickhouse = `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+		--path=*) path="${arg#--path=}" ;;
+	esac
+done
+
+exec 9>"$path/status"
+flock -n 9 || { echo "Code: 76. DB::Exception: Cannot lock file $path/status" >&2; exit 1; }
+cat > /dev/null
+sleep 0.2
+`
+
+func TestConcurrentQueries(t *testing.T) {
+	if _, err := exec.LookPath("flock"); err != nil {
+		t.Skip("flock is not available")
+	}
+
+	var (
+		dir    = t.TempDir()
+		binary = filepath.Join(dir, "clickhouse")
+	)
+
+	if err := os.WriteFile(binary, []byte(fakeClickhouse), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	eng, err := NewClickhouseLocalEngine(context.Background(), ClickhouseLocalEngineConfig{
+		BinaryPath:  binary,
+		BundlesPath: filepath.Join(dir, "bundles"),
+		Path:        filepath.Join(dir, "data"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		eng.Stop()
+		eng.Wait()
+	}()
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, 3)
+	)
+
+	for i := range errs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			_, _, errs[i] = eng.Query(context.Background(), "SELECT 1")
+		}()
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("query %d: %v", i, err)
+		}
+	}
+}
+
+func TestVarsNotModified(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		vars = map[string]any{"someVar": 1}
+	)
+
+	_, err := NewClickhouseLocalEngine(context.Background(), ClickhouseLocalEngineConfig{
+		BinaryPath:  "/bin/true",
+		BundlesPath: filepath.Join(dir, "bundles"),
+		Path:        filepath.Join(dir, "data"),
+		Vars:        vars,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vars) != 1 {
+		t.Errorf("caller's vars were modified: %v", vars)
+	}
+}
+
+// brokenClickhouse crashes on "crash", returns an exception on "exception" and takes a while on "slow".
+const brokenClickhouse = `#!/bin/sh
+case "$(cat)" in
+	crash) echo "Segmentation fault" >&2; exit 139 ;;
+	exception) echo "Code: 62. DB::Exception: Syntax error" >&2; exit 62 ;;
+	slow) sleep 0.5 ;;
+esac
+`
+
+func TestPingWhileBusy(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		binary = filepath.Join(dir, "clickhouse")
+	)
+
+	if err := os.WriteFile(binary, []byte(brokenClickhouse), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	eng, err := NewClickhouseLocalEngine(context.Background(), ClickhouseLocalEngineConfig{
+		BinaryPath:  binary,
+		BundlesPath: filepath.Join(dir, "bundles"),
+		Path:        filepath.Join(dir, "data"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		eng.Stop()
+		eng.Wait()
+	}()
+
+	// pingWhileBusy runs query, then pings while a slow query is running
+	var pingWhileBusy = func(query string) error {
+		if _, _, err := eng.Query(context.Background(), query); err == nil {
+			t.Fatalf("%s query should fail", query)
+		}
+
+		var done = make(chan struct{})
+
+		go func() {
+			defer close(done)
+			eng.Query(context.Background(), "slow")
+		}()
+
+		defer func() { <-done }()
+
+		for eng.queries.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		return eng.Ping(context.Background())
+	}
+
+	if err := pingWhileBusy("crash"); err == nil {
+		t.Errorf("Ping should fail after the binary crashed")
+	}
+
+	if err := pingWhileBusy("exception"); err != nil {
+		t.Errorf("Ping should succeed after an exception: %v", err)
+	}
+}
@@ -2,15 +2,60 @@ package impl
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/engine/impl/chlocal"
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
 	"github.com/agnosticeng/agt/internal/engine/impl/local"
+	"github.com/agnosticeng/agt/internal/engine/impl/pool"
+	"github.com/agnosticeng/agt/internal/engine/impl/record"
 	"github.com/agnosticeng/agt/internal/engine/impl/remote"
+	"github.com/agnosticeng/agt/internal/engine/impl/remotehttp"
 )
 
 type EngineConfig struct {
-	Local  *local.LocalEngineConfig
-	Remote *remote.RemoteEngineConfig
+	Local           *local.LocalEngineConfig
+	Remote          *remote.RemoteEngineConfig
+	HTTP            *remotehttp.HTTPEngineConfig
+	ClickhouseLocal *chlocal.ClickhouseLocalEngineConfig
+	Pool            *PoolConfig
+	Fake            *fake.FakeEngineConfig
+	Record          *RecordConfig
+	Replay          *record.ReplayEngineConfig
+}
+
+type PoolConfig struct {
+	pool.PoolEngineConfig
+	Members []EngineConfig
+}
+
+type RecordConfig struct {
+	record.RecordingEngineConfig
+	Engine EngineConfig
+}
+
+func (conf EngineConfig) Type() string {
+	switch {
+	case conf.Remote != nil:
+		return "remote"
+	case conf.HTTP != nil:
+		return "http"
+	case conf.ClickhouseLocal != nil:
+		return "clickhouse-local"
+	case conf.Pool != nil:
+		return "pool"
+	case conf.Fake != nil:
+		return "fake"
+	case conf.Record != nil:
+		return "record"
+	case conf.Replay != nil:
+		return "replay"
+	default:
+		return "local"
+	}
 }
 
 func NewEngine(ctx context.Context, conf EngineConfig) (engine.Engine, error) {
@@ -19,7 +64,96 @@ func NewEngine(ctx context.Context, conf EngineConfig) (engine.Engine, error) {
 		return local.NewLocalEngine(ctx, *conf.Local)
 	case conf.Remote != nil:
 		return remote.NewRemoteEngine(ctx, *conf.Remote)
+	case conf.HTTP != nil:
+		return remotehttp.NewHTTPEngine(ctx, *conf.HTTP)
+	case conf.ClickhouseLocal != nil:
+		return chlocal.NewClickhouseLocalEngine(ctx, *conf.ClickhouseLocal)
+	case conf.Pool != nil:
+		return newPoolEngine(ctx, *conf.Pool)
+	case conf.Fake != nil:
+		return fake.NewFakeEngine(*conf.Fake)
+	case conf.Record != nil:
+		return newRecordingEngine(ctx, *conf.Record)
+	case conf.Replay != nil:
+		return record.NewReplayEngine(ctx, *conf.Replay)
 	default:
 		return local.NewLocalEngine(ctx, local.LocalEngineConfig{})
 	}
 }
+
+func newPoolEngine(ctx context.Context, conf PoolConfig) (engine.Engine, error) {
+	var members = make([]engine.Engine, len(conf.Members))
+
+	for i, memberConf := range conf.Members {
+		eng, err := NewEngine(ctx, memberConf)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pool member %d: %w", i, err)
+		}
+
+		members[i] = eng
+	}
+
+	return pool.NewPoolEngine(ctx, members, conf.PoolEngineConfig)
+}
+
+func newRecordingEngine(ctx context.Context, conf RecordConfig) (engine.Engine, error) {
+	inner, err := NewEngine(ctx, conf.Engine)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recorded engine: %w", err)
+	}
+
+	return record.NewRecordingEngine(ctx, inner, conf.RecordingEngineConfig)
+}
+
+// DefaultEngineName resolves the default engine: defaultName if set, or else the only configured engine.
+// Config maps do not keep the order engines are declared in, so defaultName is required when there are several.
+func DefaultEngineName(confs map[string]EngineConfig, defaultName string) (string, error) {
+	switch {
+	case len(confs) == 0:
+		return "", fmt.Errorf("at least one engine must be configured")
+
+	case len(defaultName) > 0:
+		if _, found := confs[defaultName]; !found {
+			return "", fmt.Errorf("default engine %s is not configured", defaultName)
+		}
+
+		return defaultName, nil
+
+	case len(confs) == 1:
+		return slices.Collect(maps.Keys(confs))[0], nil
+
+	default:
+		return "", fmt.Errorf("default engine must be set when several engines are configured")
+	}
+}
+
+// NewEngines creates the named engines described by confs, defaultName being resolved by DefaultEngineName.
+func NewEngines(ctx context.Context, confs map[string]EngineConfig, defaultName string) (*engine.Engines, error) {
+	defaultName, err := DefaultEngineName(confs, defaultName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		engines = engine.Engines{
+			Default: defaultName,
+			Engines: make(map[string]engine.Engine, len(confs)),
+		}
+		names = slices.Sorted(maps.Keys(confs))
+	)
+
+	for _, name := range names {
+		eng, err := NewEngine(ctx, confs[name])
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create engine %s: %w", name, err)
+		}
+
+		engines.Engines[name] = eng
+	}
+
+	return &engines, nil
+}
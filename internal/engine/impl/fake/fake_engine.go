@@ -0,0 +1,319 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/google/uuid"
+)
+
+// ResponseConfig describes what the fake engine answers to the queries it matches.
+// A response matches a query if its Template is the name of the template the query was rendered from
+// (as found in the query ID) and its Pattern matches the rendered SQL; empty criteria match everything.
+type ResponseConfig struct {
+	Template string
+	Pattern  string
+	Rows     []map[string]any
+	Metadata engine.QueryMetadata
+	// Error makes matched queries fail with a *proto.Exception carrying ErrorCode.
+	Error     string
+	ErrorCode int32
+	// Times limits how many queries the response answers; 0 means no limit.
+	Times int
+	// Handler, when set, computes the answer instead of Rows, Metadata and Error.
+	Handler func(ctx context.Context, call Call) ([]map[string]any, *engine.QueryMetadata, error) `mapstructure:"-"`
+}
+
+type FakeEngineConfig struct {
+	Responses []ResponseConfig
+	// Strict makes queries matching no response fail instead of returning no rows.
+	// It has no effect when the engine has a fallback.
+	Strict bool
+}
+
+// Call is a query received by the fake engine.
+type Call struct {
+	Time     time.Time
+	QueryID  string
+	Template string
+	Session  string
+	Settings map[string]any
+	Query    string
+	Args     []any
+}
+
+type response struct {
+	conf    ResponseConfig
+	pattern *regexp.Regexp
+	used    int
+}
+
+// FakeEngine is an in-memory engine answering queries from a script of responses, first match wins.
+// It records every query it receives, which makes it suitable for testing pipelines without ClickHouse.
+// With a fallback engine, queries matching no response are forwarded to it, so that only some of them are mocked.
+type FakeEngine struct {
+	conf      FakeEngineConfig
+	fallback  engine.Engine
+	mu        sync.Mutex
+	responses []*response
+	calls     []Call
+	pingErr   error
+	stopOnce  sync.Once
+	stopChan  chan struct{}
+}
+
+func NewFakeEngine(conf FakeEngineConfig) (*FakeEngine, error) {
+	var eng = &FakeEngine{
+		conf:     conf,
+		stopChan: make(chan struct{}),
+	}
+
+	for _, resp := range conf.Responses {
+		if err := eng.Add(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	return eng, nil
+}
+
+// SetFallback makes the engine forward the queries matching no response to fallback,
+// whose lifecycle is then driven by the fake engine. It must be called before the engine is used.
+func (eng *FakeEngine) SetFallback(fallback engine.Engine) {
+	eng.fallback = fallback
+}
+
+// Add appends a response, which is matched after the ones already configured.
+func (eng *FakeEngine) Add(conf ResponseConfig) error {
+	var resp = response{conf: conf}
+
+	if len(conf.Pattern) > 0 {
+		pattern, err := regexp.Compile(conf.Pattern)
+
+		if err != nil {
+			return fmt.Errorf("invalid response pattern %s: %w", conf.Pattern, err)
+		}
+
+		resp.pattern = pattern
+	}
+
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+
+	eng.responses = append(eng.responses, &resp)
+	return nil
+}
+
+// SetPingError makes Ping fail with err, or succeed again if err is nil.
+func (eng *FakeEngine) SetPingError(err error) {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	eng.pingErr = err
+}
+
+// Calls returns the queries received so far, in order.
+func (eng *FakeEngine) Calls() []Call {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+	return append([]Call{}, eng.calls...)
+}
+
+// CallsFor returns the queries rendered from the given template.
+func (eng *FakeEngine) CallsFor(template string) []Call {
+	var res []Call
+
+	for _, call := range eng.Calls() {
+		if call.Template == template {
+			res = append(res, call)
+		}
+	}
+
+	return res
+}
+
+// Reset forgets the recorded calls and how many times each response was used.
+func (eng *FakeEngine) Reset() {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+
+	eng.calls = nil
+
+	for _, resp := range eng.responses {
+		resp.used = 0
+	}
+}
+
+func (eng *FakeEngine) Start() error {
+	if eng.fallback != nil {
+		return eng.fallback.Start()
+	}
+
+	return nil
+}
+
+func (eng *FakeEngine) Stop() {
+	eng.stopOnce.Do(func() {
+		close(eng.stopChan)
+
+		if eng.fallback != nil {
+			eng.fallback.Stop()
+		}
+	})
+}
+
+func (eng *FakeEngine) Wait() error {
+	<-eng.stopChan
+
+	if eng.fallback != nil {
+		return eng.fallback.Wait()
+	}
+
+	return nil
+}
+
+func (eng *FakeEngine) Ping(ctx context.Context) error {
+	eng.mu.Lock()
+	var err = eng.pingErr
+	eng.mu.Unlock()
+
+	if err == nil && eng.fallback != nil {
+		return eng.fallback.Ping(ctx)
+	}
+
+	return err
+}
+
+func (eng *FakeEngine) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	return eng.query(ctx, nil, query, args...)
+}
+
+// OpenSession opens a session on the fallback engine too, if any, for the queries that are not mocked.
+func (eng *FakeEngine) OpenSession(ctx context.Context, mode engine.SessionMode) (engine.Session, error) {
+	var sess = fakeSession{eng: eng, id: "agt-" + uuid.NewString()}
+
+	if eng.fallback != nil {
+		fallback, err := engine.OpenSession(ctx, eng.fallback, mode)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sess.fallback = fallback
+	}
+
+	return &sess, nil
+}
+
+func (eng *FakeEngine) query(ctx context.Context, sess *fakeSession, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	var call = Call{
+		Time:     time.Now(),
+		QueryID:  ch.QueryIDFromContext(ctx),
+		Settings: ch.SettingsFromContext(ctx),
+		Query:    query,
+		Args:     args,
+	}
+
+	_, call.Template = ch.ParseQueryID(call.QueryID)
+
+	if sess != nil {
+		call.Session = sess.id
+	}
+
+	eng.mu.Lock()
+	eng.calls = append(eng.calls, call)
+	var resp = eng.match(call)
+	eng.mu.Unlock()
+
+	if resp == nil {
+		switch {
+		case sess != nil && sess.fallback != nil:
+			return sess.fallback.Query(ctx, query, args...)
+		case eng.fallback != nil:
+			return eng.fallback.Query(ctx, query, args...)
+		}
+
+		if eng.conf.Strict {
+			return nil, &engine.QueryMetadata{}, fmt.Errorf("no fake response matches query %s", orQuery(call))
+		}
+
+		return nil, &engine.QueryMetadata{}, nil
+	}
+
+	if resp.Handler != nil {
+		return resp.Handler(ctx, call)
+	}
+
+	var md = resp.Metadata
+
+	if len(resp.Error) > 0 {
+		return nil, &md, &proto.Exception{Code: resp.ErrorCode, Message: resp.Error}
+	}
+
+	var rows = make([]map[string]any, len(resp.Rows))
+
+	for i, row := range resp.Rows {
+		rows[i] = maps.Clone(row)
+	}
+
+	if md.Rows == 0 {
+		md.Rows = uint64(len(rows))
+	}
+
+	return rows, &md, nil
+}
+
+// match returns the first response matching call and accounts for its use. Must be called with mu held.
+func (eng *FakeEngine) match(call Call) *ResponseConfig {
+	for _, resp := range eng.responses {
+		if resp.conf.Times > 0 && resp.used >= resp.conf.Times {
+			continue
+		}
+
+		if len(resp.conf.Template) > 0 && resp.conf.Template != call.Template {
+			continue
+		}
+
+		if resp.pattern != nil && !resp.pattern.MatchString(call.Query) {
+			continue
+		}
+
+		resp.used++
+		return &resp.conf
+	}
+
+	return nil
+}
+
+func orQuery(call Call) string {
+	if len(call.Template) > 0 {
+		return call.Template
+	}
+
+	return strings.Join(strings.Fields(call.Query), " ")
+}
+
+type fakeSession struct {
+	eng      *FakeEngine
+	id       string
+	fallback engine.Session
+}
+
+func (s *fakeSession) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	return s.eng.query(ctx, s, query, args...)
+}
+
+func (s *fakeSession) Close() error {
+	if s.fallback != nil {
+		return s.fallback.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package fake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agnosticeng/agt/internal/ch"
+)
+
+func TestMatch(t *testing.T) {
+	var tests = []struct {
+		name      string
+		responses []ResponseConfig
+		// queries are template and SQL pairs, want the value of the x column each one gets, -1 for none
+		queries [][2]string
+		want    []int
+	}{
+		{
+			name:      "empty criteria match everything",
+			responses: []ResponseConfig{{Rows: rows(1)}},
+			queries:   [][2]string{{"a", "SELECT 1"}, {"", "SELECT 2"}},
+			want:      []int{1, 1},
+		},
+		{
+			name:      "template",
+			responses: []ResponseConfig{{Template: "b", Rows: rows(1)}, {Rows: rows(2)}},
+			queries:   [][2]string{{"a", "SELECT 1"}, {"b", "SELECT 1"}, {"", "SELECT 1"}},
+			want:      []int{2, 1, 2},
+		},
+		{
+			name:      "pattern",
+			responses: []ResponseConfig{{Pattern: `(?i)insert`, Rows: rows(1)}},
+			queries:   [][2]string{{"a", "SELECT 1"}, {"a", "insert into t select 1"}},
+			want:      []int{-1, 1},
+		},
+		{
+			name:      "template and pattern must both match",
+			responses: []ResponseConfig{{Template: "a", Pattern: `^SELECT`, Rows: rows(1)}},
+			queries:   [][2]string{{"a", "SELECT 1"}, {"b", "SELECT 1"}, {"a", "INSERT 1"}},
+			want:      []int{1, -1, -1},
+		},
+		{
+			name:      "first match wins",
+			responses: []ResponseConfig{{Pattern: `SELECT`, Rows: rows(1)}, {Pattern: `SELECT 2`, Rows: rows(2)}},
+			queries:   [][2]string{{"a", "SELECT 2"}},
+			want:      []int{1},
+		},
+		{
+			name:      "times",
+			responses: []ResponseConfig{{Times: 2, Rows: rows(1)}, {Times: 1, Rows: rows(2)}},
+			queries:   [][2]string{{"a", "SELECT 1"}, {"a", "SELECT 1"}, {"a", "SELECT 1"}, {"a", "SELECT 1"}},
+			want:      []int{1, 1, 2, -1},
+		},
+		{
+			name:      "times only counts matched queries",
+			responses: []ResponseConfig{{Template: "b", Times: 1, Rows: rows(1)}, {Rows: rows(2)}},
+			queries:   [][2]string{{"a", "SELECT 1"}, {"b", "SELECT 1"}, {"b", "SELECT 1"}},
+			want:      []int{2, 1, 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eng, err := NewFakeEngine(FakeEngineConfig{Responses: test.responses})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, query := range test.queries {
+				var ctx = context.Background()
+
+				if len(query[0]) > 0 {
+					ctx = ch.WithQueryID(ctx, "agt:run:stage:0:"+query[0])
+				}
+
+				res, _, err := eng.Query(ctx, query[1])
+
+				if err != nil {
+					t.Fatalf("query %d: %v", i, err)
+				}
+
+				var got = -1
+
+				if len(res) > 0 {
+					got = res[0]["x"].(int)
+				}
+
+				if got != test.want[i] {
+					t.Errorf("query %d (%s, %s) got response %d, want %d", i, query[0], query[1], got, test.want[i])
+				}
+			}
+
+			if calls := eng.Calls(); len(calls) != len(test.queries) {
+				t.Errorf("got %d calls, want %d", len(calls), len(test.queries))
+			}
+		})
+	}
+}
+
+func TestStrict(t *testing.T) {
+	eng, err := NewFakeEngine(FakeEngineConfig{Strict: true, Responses: []ResponseConfig{{Template: "a"}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := eng.Query(ch.WithQueryID(context.Background(), "agt:run:stage:0:a"), "SELECT 1"); err != nil {
+		t.Errorf("matched query failed: %v", err)
+	}
+
+	if _, _, err := eng.Query(ch.WithQueryID(context.Background(), "agt:run:stage:0:b"), "SELECT 1"); err == nil {
+		t.Errorf("unmatched query should fail in strict mode")
+	}
+}
+
+func TestReset(t *testing.T) {
+	eng, err := NewFakeEngine(FakeEngineConfig{Responses: []ResponseConfig{{Times: 1, Rows: rows(1)}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		res, _, err := eng.Query(context.Background(), "SELECT 1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != 1 {
+			t.Errorf("query %d got %d rows, want 1", i, len(res))
+		}
+
+		eng.Reset()
+
+		if calls := eng.Calls(); len(calls) != 0 {
+			t.Errorf("got %d calls after Reset, want 0", len(calls))
+		}
+	}
+}
+
+func rows(x int) []map[string]any {
+	return []map[string]any{{"x": x}}
+}
@@ -0,0 +1,131 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/mholt/archiver/v4"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+// DefaultBundlesPath returns the directory where downloaded bundles are cached when none is configured.
+func DefaultBundlesPath() (string, error) {
+	path, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(path, "agt/bundles"), nil
+}
+
+// InstallBundles downloads the given bundles (cached in bundlesPath) and extracts them into dstPath.
+// Bundle URLs are templates rendered with vars.
+// Server config files (e.g. executable UDF definitions) land at the root of dstPath,
+// while SQL UDFs and UDF scripts go to the user_defined and user_scripts subdirectories.
+func InstallBundles(ctx context.Context, bundles []string, bundlesPath string, vars map[string]any, dstPath string) error {
+	var logger = slogctx.FromCtx(ctx)
+
+	if len(bundles) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(bundlesPath, 0700); err != nil {
+		return err
+	}
+
+	for _, remote := range bundles {
+		var local = filepath.Join(bundlesPath, utils.SHA256Sum(remote))
+
+		t, err := template.New("").Funcs(sprig.FuncMap()).Parse(remote)
+
+		if err != nil {
+			return err
+		}
+
+		remotePath, err := utils.RenderTemplate(t, "", vars)
+
+		if err != nil {
+			return err
+		}
+
+		logger.Debug("downloading bundle", "url", remotePath, "path", local)
+
+		if err := utils.CachedDownload(ctx, remotePath, local); err != nil {
+			return fmt.Errorf("error while downloading bundle %s: %w", remote, err)
+		}
+
+		f, err := os.Open(local)
+
+		if err != nil {
+			return err
+		}
+
+		format, r, err := archiver.Identify(ctx, local, f)
+
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		if ex, ok := format.(archiver.Extractor); ok {
+			logger.Debug("extracting bundle", "path", local)
+
+			if err := ex.Extract(ctx, r, extractBundle(dstPath)); err != nil {
+				f.Close()
+				return err
+			}
+		}
+
+		f.Close()
+	}
+
+	return nil
+}
+
+func extractBundle(basePath string) func(ctx context.Context, info archiver.FileInfo) error {
+	return func(ctx context.Context, info archiver.FileInfo) error {
+		var dstPath string
+
+		switch filepath.Dir(info.NameInArchive) {
+		case "/etc/clickhouse-server", "etc/clickhouse-server":
+			dstPath = filepath.Join(basePath, filepath.Base(info.NameInArchive))
+		case "/var/lib/clickhouse/user_defined", "var/lib/clickhouse/user_defined":
+			dstPath = filepath.Join(basePath, "user_defined", filepath.Base(info.NameInArchive))
+		case "/var/lib/clickhouse/user_scripts", "var/lib/clickhouse/user_scripts":
+			dstPath = filepath.Join(basePath, "user_scripts", filepath.Base(info.NameInArchive))
+		default:
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dstPath), 0744); err != nil {
+			return err
+		}
+
+		r, err := info.Open()
+
+		if err != nil {
+			return err
+		}
+
+		defer r.Close()
+
+		w, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE, info.FileInfo.Mode())
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+
+		return w.Close()
+	}
+}
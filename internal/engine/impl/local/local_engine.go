@@ -1,6 +1,7 @@
 package local
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -13,18 +14,16 @@ import (
 	"os/exec"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 	"syscall"
-	"text/template"
+	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
-	"github.com/Masterminds/sprig"
 	"github.com/agnosticeng/agt/internal/ch"
 	"github.com/agnosticeng/agt/internal/engine"
-	"github.com/agnosticeng/agt/internal/utils"
 	"github.com/iancoleman/strcase"
-	"github.com/mholt/archiver/v4"
 	slogctx "github.com/veqryn/slog-context"
 	"gopkg.in/yaml.v3"
 )
@@ -41,13 +40,18 @@ type LocalEngineConfig struct {
 	Settings       map[string]any
 	Vars           map[string]any
 	Logging        ch.LogHandlerConfig
+	ProfileEvents  []string
+	ServerLogging  ServerLoggingConfig
 }
 
 type LocalEngine struct {
-	conf     LocalEngineConfig
-	logger   *slog.Logger
-	cmd      *exec.Cmd
-	connFunc func() (driver.Conn, error)
+	conf      LocalEngineConfig
+	logger    *slog.Logger
+	logFilter *ch.LogFilter
+	cmd       *exec.Cmd
+	logWriter *io.PipeWriter
+	logs      *serverLogForwarder
+	connFunc  func() (driver.Conn, error)
 }
 
 func NewLocalEngine(ctx context.Context, conf LocalEngineConfig) (*LocalEngine, error) {
@@ -57,20 +61,37 @@ func NewLocalEngine(ctx context.Context, conf LocalEngineConfig) (*LocalEngine,
 		conf.BinaryPath = "clickhouse"
 	}
 
+	conf.ServerLogging = conf.ServerLogging.WithDefaults()
+
+	if len(conf.ProfileEvents) == 0 {
+		conf.ProfileEvents = ch.DefaultProfileEvents
+	}
+
+	logFilter, err := ch.NewLogFilter(conf.Logging)
+
+	if err != nil {
+		return nil, err
+	}
+
 	if len(conf.BundlesPath) == 0 {
-		path, err := os.UserCacheDir()
+		path, err := DefaultBundlesPath()
 
 		if err != nil {
 			return nil, err
 		}
 
-		conf.BundlesPath = filepath.Join(path, "agt/bundles")
+		conf.BundlesPath = path
 	}
 
+	// vars are also made available under their screaming snake case name, without modifying the caller's map
+	var vars = maps.Clone(conf.Vars)
+
 	for k, v := range conf.Vars {
-		conf.Vars[strcase.ToScreamingSnake(k)] = v
+		vars[strcase.ToScreamingSnake(k)] = v
 	}
 
+	conf.Vars = vars
+
 	if !filepath.IsAbs(conf.BinaryPath) {
 		path, err := exec.LookPath(conf.BinaryPath)
 
@@ -115,7 +136,7 @@ func NewLocalEngine(ctx context.Context, conf LocalEngineConfig) (*LocalEngine,
 	logger.Info("local clickhouse server network config", "hostname", u.Hostname(), "port", u.Port())
 
 	var finalSettings = make(map[string]interface{})
-	maps.Copy(finalSettings, generateDefaultSettings(u))
+	maps.Copy(finalSettings, generateDefaultSettings(u, conf.ServerLogging))
 	maps.Copy(finalSettings, ch.NormalizeSettings(conf.ServerSettings))
 
 	data, err := yaml.Marshal(finalSettings)
@@ -128,52 +149,8 @@ func NewLocalEngine(ctx context.Context, conf LocalEngineConfig) (*LocalEngine,
 		return nil, err
 	}
 
-	if len(conf.Bundles) > 0 {
-		if err := os.MkdirAll(conf.BundlesPath, 0700); err != nil {
-			return nil, err
-		}
-
-		for _, remote := range conf.Bundles {
-			var local = filepath.Join(conf.BundlesPath, utils.SHA256Sum(remote))
-
-			t, err := template.New("").Funcs(sprig.FuncMap()).Parse(remote)
-
-			if err != nil {
-				return nil, err
-			}
-
-			remotePath, err := utils.RenderTemplate(t, "", conf.Vars)
-
-			if err != nil {
-				return nil, err
-			}
-
-			logger.Debug("downloading bundle", "url", remotePath, "path", local)
-
-			if err := utils.CachedDownload(ctx, remotePath, local); err != nil {
-				return nil, fmt.Errorf("error while downloading bundle %s: %w", remote, err)
-			}
-
-			f, err := os.Open(local)
-
-			if err != nil {
-				return nil, err
-			}
-
-			format, r, err := archiver.Identify(ctx, local, f)
-
-			if err != nil {
-				return nil, err
-			}
-
-			if ex, ok := format.(archiver.Extractor); ok {
-				logger.Debug("extracting bundle", "path", local)
-
-				if err := ex.Extract(ctx, r, extractBundle(conf.WorkingDir)); err != nil {
-					return nil, err
-				}
-			}
-		}
+	if err := InstallBundles(ctx, conf.Bundles, conf.BundlesPath, conf.Vars, conf.WorkingDir); err != nil {
+		return nil, err
 	}
 
 	var cmd = exec.Command(
@@ -184,21 +161,24 @@ func NewLocalEngine(ctx context.Context, conf LocalEngineConfig) (*LocalEngine,
 		"--errorlog-file=clickhouse-server-error.log",
 	)
 
+	var logReader, logWriter = io.Pipe()
+
 	cmd.Dir = conf.WorkingDir
 	cmd.Env = slices.Clone(os.Environ())
+	cmd.Stdout = logWriter
+	cmd.Stderr = logWriter
 
 	for k, v := range conf.Env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", strcase.ToScreamingSnake(k), v))
 	}
 
 	connFunc := sync.OnceValues(func() (driver.Conn, error) {
-		chopts, err := clickhouse.ParseDSN(conf.Dsn)
+		chopts, err := clientOptions(conf)
 
 		if err != nil {
 			return nil, err
 		}
 
-		chopts.Settings = clickhouse.Settings(ch.NormalizeSettings(conf.Settings))
 		chconn, err := clickhouse.Open(chopts)
 
 		if err != nil {
@@ -208,17 +188,29 @@ func NewLocalEngine(ctx context.Context, conf LocalEngineConfig) (*LocalEngine,
 		return chconn, nil
 	})
 
+	var logs = newServerLogForwarder(logger, conf.ServerLogging)
+	go logs.Run(logReader)
+
 	return &LocalEngine{
-		conf:     conf,
-		logger:   logger,
-		cmd:      cmd,
-		connFunc: connFunc,
+		conf:      conf,
+		logger:    logger,
+		logFilter: logFilter,
+		cmd:       cmd,
+		logWriter: logWriter,
+		logs:      logs,
+		connFunc:  connFunc,
 	}, nil
 }
 
 func (eng *LocalEngine) Start() error {
 	eng.logger.Info("starting local clickhouse server")
-	return eng.cmd.Start()
+
+	if err := eng.cmd.Start(); err != nil {
+		eng.logWriter.Close()
+		return err
+	}
+
+	return nil
 }
 
 func (eng *LocalEngine) Stop() {
@@ -256,19 +248,22 @@ func (eng *LocalEngine) Wait() error {
 	eng.logger.Info("waiting for local clickhouse server to stop")
 	var err = eng.cmd.Wait()
 
+	eng.logWriter.Close()
+	eng.logs.Wait()
+
 	if err == nil {
 		return nil
 	}
 
-	if exitError, ok := err.(*exec.ExitError); ok {
-		if exitError.ExitCode() != 143 {
-			eng.logger.Error("clickhouse server error", "log", string(exitError.Stderr))
-		} else {
-			return nil
-		}
+	if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 143 {
+		return nil
+	}
+
+	if lines := eng.logs.ErrorLines(); len(lines) > 0 {
+		return fmt.Errorf("local clickhouse server exited: %w\n%s", err, strings.Join(lines, "\n"))
 	}
 
-	return err
+	return fmt.Errorf("local clickhouse server exited: %w", err)
 }
 
 func (eng *LocalEngine) Ping(ctx context.Context) error {
@@ -288,14 +283,95 @@ func (eng *LocalEngine) Query(ctx context.Context, query string, args ...any) ([
 		return nil, nil, err
 	}
 
+	return eng.query(ctx, conn, query, args...)
+}
+
+func (eng *LocalEngine) OpenSession(ctx context.Context, mode engine.SessionMode) (engine.Session, error) {
+	chopts, err := clientOptions(eng.conf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ch.OpenSessionConn(*chopts, mode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &localSession{eng: eng, conn: conn}, nil
+}
+
+// QueryStream runs the query with clickhouse client, which writes its output in the given format to w.
+func (eng *LocalEngine) QueryStream(ctx context.Context, query string, format string, w io.Writer) (*engine.QueryMetadata, error) {
+	var (
+		md = engine.QueryMetadata{}
+		t0 = time.Now()
+	)
+
+	u, err := url.Parse(eng.conf.Dsn)
+
+	if err != nil {
+		return &md, err
+	}
+
+	var (
+		settings = make(map[string]any)
+		args     = []string{
+			"client",
+			"--host=" + u.Hostname(),
+			"--port=" + u.Port(),
+			"--format=" + format,
+		}
+	)
+
+	if database := strings.Trim(u.Path, "/"); len(database) > 0 {
+		args = append(args, "--database="+database)
+	}
+
+	maps.Copy(settings, ch.NormalizeSettings(eng.conf.Settings))
+	maps.Copy(settings, ch.SettingsFromContext(ctx))
+
+	for _, k := range slices.Sorted(maps.Keys(settings)) {
+		args = append(args, fmt.Sprintf("--%s=%v", k, settings[k]))
+	}
+
+	if queryID := ch.QueryIDFromContext(ctx); len(queryID) > 0 {
+		args = append(args, "--query_id="+queryID)
+	}
+
+	var (
+		stderr bytes.Buffer
+		cmd    = exec.CommandContext(ctx, eng.conf.BinaryPath, args...)
+	)
+
+	cmd.Stdin = strings.NewReader(query)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	md.Elapsed = time.Since(t0)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return &md, ctx.Err()
+		}
+
+		return &md, ch.ParseCLIException("client", stderr.Bytes(), err)
+	}
+
+	return &md, nil
+}
+
+func (eng *LocalEngine) query(ctx context.Context, conn driver.Conn, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
 	var md engine.QueryMetadata
 
 	rows, err := conn.Query(
 		clickhouse.Context(
 			ctx,
 			clickhouse.WithProgress(ch.ProgressHandler(&md)),
-			clickhouse.WithLogs(ch.LogHandler(eng.logger, eng.conf.Logging)),
-			clickhouse.WithProfileEvents(ch.ProfileEventHandler(&md)),
+			clickhouse.WithLogs(ch.LogHandler(slogctx.FromCtx(ctx), eng.logFilter)),
+			clickhouse.WithProfileEvents(ch.ProfileEventHandler(&md, eng.conf.ProfileEvents)),
 		),
 		query,
 		args...,
@@ -309,49 +385,33 @@ func (eng *LocalEngine) Query(ctx context.Context, query string, args ...any) ([
 		return nil, &md, err
 	}
 
+	md.Columns = rows.Columns()
 	res, err := ch.RowsToMaps(rows)
 	return res, &md, err
 }
 
-func extractBundle(basePath string) func(ctx context.Context, info archiver.FileInfo) error {
-	return func(ctx context.Context, info archiver.FileInfo) error {
-		var dstPath string
-
-		switch filepath.Dir(info.NameInArchive) {
-		case "/etc/clickhouse-server", "etc/clickhouse-server":
-			dstPath = filepath.Join(basePath, filepath.Base(info.NameInArchive))
-		case "/var/lib/clickhouse/user_defined", "var/lib/clickhouse/user_defined":
-			dstPath = filepath.Join(basePath, "user_defined", filepath.Base(info.NameInArchive))
-		case "/var/lib/clickhouse/user_scripts", "var/lib/clickhouse/user_scripts":
-			dstPath = filepath.Join(basePath, "user_scripts", filepath.Base(info.NameInArchive))
-		default:
-			return nil
-		}
-
-		if err := os.MkdirAll(filepath.Dir(dstPath), 0744); err != nil {
-			return err
-		}
-
-		r, err := info.Open()
-
-		if err != nil {
-			return err
-		}
-
-		defer r.Close()
+type localSession struct {
+	eng  *LocalEngine
+	conn driver.Conn
+}
 
-		w, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE, info.FileInfo.Mode())
+func (s *localSession) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	return s.eng.query(ctx, s.conn, query, args...)
+}
 
-		if err != nil {
-			return err
-		}
+func (s *localSession) Close() error {
+	return s.conn.Close()
+}
 
-		if _, err := io.Copy(w, r); err != nil {
-			return err
-		}
+func clientOptions(conf LocalEngineConfig) (*clickhouse.Options, error) {
+	chopts, err := clickhouse.ParseDSN(conf.Dsn)
 
-		return w.Close()
+	if err != nil {
+		return nil, err
 	}
+
+	chopts.Settings = clickhouse.Settings(ch.NormalizeSettings(conf.Settings))
+	return chopts, nil
 }
 
 func findFreePort(host string) (int, error) {
@@ -371,7 +431,7 @@ func findFreePort(host string) (int, error) {
 	return l.Addr().(*net.TCPAddr).Port, nil
 }
 
-func generateDefaultSettings(dsn *url.URL) clickhouse.Settings {
+func generateDefaultSettings(dsn *url.URL, logging ServerLoggingConfig) clickhouse.Settings {
 	var settings = make(clickhouse.Settings)
 
 	settings["path"] = "./"
@@ -388,6 +448,10 @@ func generateDefaultSettings(dsn *url.URL) clickhouse.Settings {
 			"named_collection_control": 1,
 		},
 	}
+	settings["logger"] = map[string]any{
+		"level":   logging.Level,
+		"console": 1,
+	}
 	settings["shutdown_wait_unfinished_queries"] = 0
 	settings["cache_size_to_ram_max_ratio"] = 0.1
 	settings["cgroup_memory_watcher_soft_limit_ratio"] = 0.25
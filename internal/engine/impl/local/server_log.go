@@ -0,0 +1,120 @@
+package local
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+)
+
+type ServerLoggingConfig struct {
+	Level      string
+	ErrorLines int
+}
+
+func (conf ServerLoggingConfig) WithDefaults() ServerLoggingConfig {
+	if len(conf.Level) == 0 {
+		conf.Level = "information"
+	}
+
+	if conf.ErrorLines <= 0 {
+		conf.ErrorLines = 20
+	}
+
+	return conf
+}
+
+type serverLogForwarder struct {
+	logger     *slog.Logger
+	maxLines   int
+	mu         sync.Mutex
+	errorLines []string
+	done       chan struct{}
+}
+
+func newServerLogForwarder(logger *slog.Logger, conf ServerLoggingConfig) *serverLogForwarder {
+	return &serverLogForwarder{
+		logger:   logger.With("component", "clickhouse-server"),
+		maxLines: conf.ErrorLines,
+		done:     make(chan struct{}),
+	}
+}
+
+func (f *serverLogForwarder) Run(r io.Reader) {
+	defer close(f.done)
+
+	var (
+		scanner = bufio.NewScanner(r)
+		last    *engine.Log
+	)
+
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var line = scanner.Text()
+
+		if len(line) == 0 {
+			continue
+		}
+
+		l, ok := ch.ParseServerLogLine(line)
+
+		if !ok {
+			// continuation of a multi-line entry (e.g. a stack trace): keep the level of the previous entry
+			if last != nil {
+				f.emit(&engine.Log{Priority: last.Priority, Source: last.Source, ThreadID: last.ThreadID, Text: line}, line)
+			} else {
+				f.emit(&engine.Log{Priority: ch.PriorityInformation, Text: line}, line)
+			}
+
+			continue
+		}
+
+		last = l
+		f.emit(l, line)
+	}
+
+	// keep draining so that the server never blocks on a full pipe
+	io.Copy(io.Discard, r)
+}
+
+func (f *serverLogForwarder) emit(l *engine.Log, raw string) {
+	var level = ch.PriorityToLevel(l.Priority)
+
+	if level >= slog.LevelError {
+		f.mu.Lock()
+		f.errorLines = append(f.errorLines, raw)
+
+		if len(f.errorLines) > f.maxLines {
+			f.errorLines = f.errorLines[len(f.errorLines)-f.maxLines:]
+		}
+
+		f.mu.Unlock()
+	}
+
+	f.logger.Log(
+		context.Background(),
+		level,
+		l.Text,
+		"thread_id", l.ThreadID,
+		"query_id", l.QueryID,
+		"source", l.Source,
+	)
+}
+
+func (f *serverLogForwarder) Wait() {
+	<-f.done
+}
+
+func (f *serverLogForwarder) ErrorLines() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var res = make([]string, len(f.errorLines))
+	copy(res, f.errorLines)
+	return res
+}
@@ -0,0 +1,329 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/engine"
+	slogctx "github.com/veqryn/slog-context"
+	"golang.org/x/sync/errgroup"
+)
+
+type Strategy string
+
+var (
+	RoundRobin  Strategy = "ROUND_ROBIN"
+	LeastLoaded Strategy = "LEAST_LOADED"
+)
+
+type PoolEngineConfig struct {
+	Strategy            Strategy
+	Sticky              bool
+	StickyTTL           time.Duration
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+}
+
+func (conf PoolEngineConfig) WithDefaults() PoolEngineConfig {
+	if len(conf.Strategy) == 0 {
+		conf.Strategy = RoundRobin
+	}
+
+	if conf.StickyTTL == 0 {
+		conf.StickyTTL = 10 * time.Minute
+	}
+
+	if conf.HealthCheckInterval == 0 {
+		conf.HealthCheckInterval = 5 * time.Second
+	}
+
+	if conf.HealthCheckTimeout == 0 {
+		conf.HealthCheckTimeout = 2 * time.Second
+	}
+
+	return conf
+}
+
+type member struct {
+	index    int
+	engine   engine.Engine
+	inFlight atomic.Int64
+	healthy  atomic.Bool
+}
+
+// route remembers which member serves a unit of work when the pool is sticky.
+type route struct {
+	member   *member
+	lastUsed time.Time
+}
+
+// PoolEngine spreads queries over several engines.
+// Members failing to answer pings are ejected until they answer again.
+// When sticky, the queries of a unit of work (see engine.WithAffinity) go to the same member
+// for as long as it stays healthy, so that session state such as temporary tables is preserved.
+type PoolEngine struct {
+	conf     PoolEngineConfig
+	logger   *slog.Logger
+	members  []*member
+	next     atomic.Uint64
+	mu       sync.Mutex
+	routes   map[string]*route
+	stopOnce sync.Once
+	stopChan chan struct{}
+}
+
+func NewPoolEngine(ctx context.Context, engines []engine.Engine, conf PoolEngineConfig) (*PoolEngine, error) {
+	conf = conf.WithDefaults()
+
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("pool must have at least 1 member")
+	}
+
+	switch conf.Strategy {
+	case RoundRobin, LeastLoaded:
+	default:
+		return nil, fmt.Errorf("unknown pool strategy: %s", conf.Strategy)
+	}
+
+	var members = make([]*member, len(engines))
+
+	for i, eng := range engines {
+		members[i] = &member{index: i, engine: eng}
+		members[i].healthy.Store(true)
+	}
+
+	return &PoolEngine{
+		conf:     conf,
+		logger:   slogctx.FromCtx(ctx),
+		members:  members,
+		routes:   make(map[string]*route),
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+func (eng *PoolEngine) Start() error {
+	for i, m := range eng.members {
+		if err := m.engine.Start(); err != nil {
+			for _, started := range eng.members[:i] {
+				started.engine.Stop()
+			}
+
+			return fmt.Errorf("failed to start pool member %d: %w", i, err)
+		}
+	}
+
+	go eng.healthCheckLoop()
+	return nil
+}
+
+func (eng *PoolEngine) Stop() {
+	eng.stopOnce.Do(func() {
+		close(eng.stopChan)
+
+		for _, m := range eng.members {
+			m.engine.Stop()
+		}
+	})
+}
+
+// Wait returns once every member has stopped, since the pool keeps serving as long as one is left.
+func (eng *PoolEngine) Wait() error {
+	var group errgroup.Group
+
+	for _, m := range eng.members {
+		group.Go(m.engine.Wait)
+	}
+
+	return group.Wait()
+}
+
+// Ping checks every member, updating their health, and succeeds if at least one is healthy.
+func (eng *PoolEngine) Ping(ctx context.Context) error {
+	var lastErr error
+
+	for _, m := range eng.members {
+		if err := eng.check(ctx, m); err != nil {
+			lastErr = err
+		}
+	}
+
+	if eng.healthyCount() == 0 {
+		return fmt.Errorf("no healthy pool member: %w", lastErr)
+	}
+
+	return nil
+}
+
+func (eng *PoolEngine) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	m, err := eng.pick(engine.AffinityFromContext(ctx))
+
+	if err != nil {
+		return nil, &engine.QueryMetadata{}, err
+	}
+
+	m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+
+	return m.engine.Query(slogctx.With(ctx, "pool_member", m.index), query, args...)
+}
+
+// QueryStream streams the query from a single member, picked as a query would be.
+func (eng *PoolEngine) QueryStream(ctx context.Context, query string, format string, w io.Writer) (*engine.QueryMetadata, error) {
+	m, err := eng.pick(engine.AffinityFromContext(ctx))
+
+	if err != nil {
+		return &engine.QueryMetadata{}, err
+	}
+
+	m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+
+	return engine.QueryStream(slogctx.With(ctx, "pool_member", m.index), m.engine, query, format, w)
+}
+
+// OpenSession opens the session on a single member, picked as a query would be.
+func (eng *PoolEngine) OpenSession(ctx context.Context, mode engine.SessionMode) (engine.Session, error) {
+	m, err := eng.pick(engine.AffinityFromContext(ctx))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := engine.OpenSession(ctx, m.engine, mode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &poolSession{Session: sess, member: m}, nil
+}
+
+type poolSession struct {
+	engine.Session
+	member *member
+}
+
+func (s *poolSession) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	s.member.inFlight.Add(1)
+	defer s.member.inFlight.Add(-1)
+
+	return s.Session.Query(slogctx.With(ctx, "pool_member", s.member.index), query, args...)
+}
+
+func (eng *PoolEngine) pick(affinity string) (*member, error) {
+	if !eng.conf.Sticky || len(affinity) == 0 {
+		return eng.pickMember()
+	}
+
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+
+	if r, found := eng.routes[affinity]; found && r.member.healthy.Load() {
+		r.lastUsed = time.Now()
+		return r.member, nil
+	}
+
+	m, err := eng.pickMember()
+
+	if err != nil {
+		return nil, err
+	}
+
+	eng.routes[affinity] = &route{member: m, lastUsed: time.Now()}
+	return m, nil
+}
+
+func (eng *PoolEngine) pickMember() (*member, error) {
+	var res *member
+
+	switch eng.conf.Strategy {
+	case LeastLoaded:
+		var offset = int(eng.next.Add(1))
+
+		for i := range eng.members {
+			var m = eng.members[(offset+i)%len(eng.members)]
+
+			if m.healthy.Load() && (res == nil || m.inFlight.Load() < res.inFlight.Load()) {
+				res = m
+			}
+		}
+
+	default:
+		for range eng.members {
+			var m = eng.members[int(eng.next.Add(1)-1)%len(eng.members)]
+
+			if m.healthy.Load() {
+				res = m
+				break
+			}
+		}
+	}
+
+	if res == nil {
+		return nil, fmt.Errorf("no healthy pool member")
+	}
+
+	return res, nil
+}
+
+func (eng *PoolEngine) healthCheckLoop() {
+	var ticker = time.NewTicker(eng.conf.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-eng.stopChan:
+			return
+		case <-ticker.C:
+			for _, m := range eng.members {
+				eng.check(context.Background(), m)
+			}
+
+			eng.pruneRoutes()
+		}
+	}
+}
+
+func (eng *PoolEngine) check(ctx context.Context, m *member) error {
+	ctx, cancel := context.WithTimeout(ctx, eng.conf.HealthCheckTimeout)
+	defer cancel()
+
+	var err = m.engine.Ping(ctx)
+
+	switch {
+	case err != nil && m.healthy.Swap(false):
+		eng.logger.Warn("pool member ejected", "pool_member", m.index, "error", err.Error())
+	case err == nil && !m.healthy.Swap(true):
+		eng.logger.Info("pool member restored", "pool_member", m.index)
+	}
+
+	return err
+}
+
+func (eng *PoolEngine) healthyCount() int {
+	var n int
+
+	for _, m := range eng.members {
+		if m.healthy.Load() {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (eng *PoolEngine) pruneRoutes() {
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+
+	for key, r := range eng.routes {
+		if time.Since(r.lastUsed) > eng.conf.StickyTTL {
+			delete(eng.routes, key)
+		}
+	}
+}
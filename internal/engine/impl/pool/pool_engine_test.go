@@ -0,0 +1,184 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
+)
+
+func TestPick(t *testing.T) {
+	var tests = []struct {
+		name      string
+		conf      PoolEngineConfig
+		unhealthy []int
+		inFlight  []int64
+		affinity  []string
+		want      []int
+	}{
+		{
+			name: "round robin",
+			want: []int{0, 1, 2, 0, 1, 2},
+		},
+		{
+			name:      "round robin skips unhealthy members",
+			unhealthy: []int{1},
+			want:      []int{0, 2, 0, 2},
+		},
+		{
+			name:     "least loaded",
+			conf:     PoolEngineConfig{Strategy: LeastLoaded},
+			inFlight: []int64{2, 0, 1},
+			want:     []int{1, 1, 1},
+		},
+		{
+			name:      "least loaded skips unhealthy members",
+			conf:      PoolEngineConfig{Strategy: LeastLoaded},
+			unhealthy: []int{1},
+			inFlight:  []int64{2, 0, 1},
+			want:      []int{2, 2},
+		},
+		{
+			name:     "not sticky",
+			affinity: []string{"a", "a", "a"},
+			want:     []int{0, 1, 2},
+		},
+		{
+			name:     "sticky",
+			conf:     PoolEngineConfig{Sticky: true},
+			affinity: []string{"a", "b", "a", "", "b", "c"},
+			want:     []int{0, 1, 0, 2, 1, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var eng = newTestPool(t, 3, test.conf)
+
+			for _, i := range test.unhealthy {
+				eng.members[i].healthy.Store(false)
+			}
+
+			for i, n := range test.inFlight {
+				eng.members[i].inFlight.Store(n)
+			}
+
+			var got []int
+
+			for i := range test.want {
+				var affinity string
+
+				if i < len(test.affinity) {
+					affinity = test.affinity[i]
+				}
+
+				m, err := eng.pick(affinity)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got = append(got, m.index)
+			}
+
+			if !slices.Equal(got, test.want) {
+				t.Errorf("picked %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEjection(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		eng     = newTestPool(t, 2, PoolEngineConfig{Sticky: true})
+		fakes   = []*fake.FakeEngine{eng.members[0].engine.(*fake.FakeEngine), eng.members[1].engine.(*fake.FakeEngine)}
+		errDown = errors.New("down")
+	)
+
+	var picked = func(affinity string) int {
+		t.Helper()
+
+		res, _, err := eng.Query(engine.WithAffinity(ctx, affinity), "SELECT 1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return res[0]["member"].(int)
+	}
+
+	if m := picked("a"); m != 0 {
+		t.Fatalf("a routed to %d, want 0", m)
+	}
+
+	fakes[0].SetPingError(errDown)
+
+	if err := eng.Ping(ctx); err != nil {
+		t.Fatalf("the pool should stay up with a healthy member: %v", err)
+	}
+
+	if eng.members[0].healthy.Load() {
+		t.Errorf("member 0 should be ejected")
+	}
+
+	// the route of a moves to the remaining member, and stays there once member 0 is restored
+	if m := picked("a"); m != 1 {
+		t.Errorf("a routed to %d after ejection, want 1", m)
+	}
+
+	fakes[1].SetPingError(errDown)
+
+	if err := eng.Ping(ctx); !errors.Is(err, errDown) {
+		t.Errorf("Ping() = %v, want %v", err, errDown)
+	}
+
+	if _, _, err := eng.Query(ctx, "SELECT 1"); err == nil {
+		t.Errorf("queries should fail without healthy member")
+	}
+
+	fakes[0].SetPingError(nil)
+	fakes[1].SetPingError(nil)
+
+	if err := eng.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !eng.members[0].healthy.Load() || !eng.members[1].healthy.Load() {
+		t.Errorf("members should be restored")
+	}
+
+	if m := picked("a"); m != 1 {
+		t.Errorf("a routed to %d after restoration, want 1", m)
+	}
+}
+
+// newTestPool returns a pool of fake engines, each one answering with its index in the member column.
+func newTestPool(t *testing.T, n int, conf PoolEngineConfig) *PoolEngine {
+	t.Helper()
+
+	var engines []engine.Engine
+
+	for i := range n {
+		eng, err := fake.NewFakeEngine(fake.FakeEngineConfig{
+			Responses: []fake.ResponseConfig{{Rows: []map[string]any{{"member": i}}}},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		engines = append(engines, eng)
+	}
+
+	eng, err := NewPoolEngine(context.Background(), engines, conf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return eng
+}
@@ -0,0 +1,424 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
+)
+
+const runPlaceholder = "<UUID>"
+
+// Record is a query and its outcome, as stored in a recording file (one JSON record per line).
+// Columns holds the Go type of each column so that replayed rows hold the same types as live ones.
+type Record struct {
+	Time     time.Time                    `json:"time"`
+	QueryID  string                       `json:"query_id,omitempty"`
+	Template string                       `json:"template,omitempty"`
+	Query    string                       `json:"query"`
+	Columns  map[string]string            `json:"columns,omitempty"`
+	Rows     []map[string]json.RawMessage `json:"rows,omitempty"`
+	Metadata engine.QueryMetadata         `json:"metadata"`
+	Error    *RecordedError               `json:"error,omitempty"`
+}
+
+type RecordedError struct {
+	Code    int32  `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func newRecord(queryID string, query string, rows []map[string]any, md *engine.QueryMetadata, err error) (*Record, error) {
+	var rec = Record{
+		Time:    time.Now(),
+		QueryID: queryID,
+		Query:   query,
+	}
+
+	_, rec.Template = ch.ParseQueryID(queryID)
+
+	if md != nil {
+		rec.Metadata = *md
+	}
+
+	if ex, ok := lo.ErrorsAs[*proto.Exception](err); ok {
+		rec.Error = &RecordedError{Code: ex.Code, Message: ex.Message}
+	} else if err != nil {
+		rec.Error = &RecordedError{Message: err.Error()}
+	}
+
+	for _, row := range rows {
+		var rawRow = make(map[string]json.RawMessage, len(row))
+
+		for k, v := range row {
+			js, err := marshalValue(v)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to record column %s: %w", k, err)
+			}
+
+			rawRow[k] = js
+
+			if _, found := rec.Columns[k]; !found && v != nil {
+				if rec.Columns == nil {
+					rec.Columns = make(map[string]string)
+				}
+
+				rec.Columns[k] = reflect.TypeOf(v).String()
+			}
+		}
+
+		rec.Rows = append(rec.Rows, rawRow)
+	}
+
+	return &rec, nil
+}
+
+// result turns the record back into what the recorded engine returned.
+func (rec *Record) result() ([]map[string]any, *engine.QueryMetadata, error) {
+	var md = rec.Metadata
+
+	if rec.Error != nil {
+		if rec.Error.Code != 0 {
+			return nil, &md, &proto.Exception{Code: rec.Error.Code, Message: rec.Error.Message}
+		}
+
+		return nil, &md, fmt.Errorf("%s", rec.Error.Message)
+	}
+
+	var rows = make([]map[string]any, 0, len(rec.Rows))
+
+	for _, rawRow := range rec.Rows {
+		var row = make(map[string]any, len(rawRow))
+
+		for k, raw := range rawRow {
+			v, err := decodeValue(rec.Columns[k], raw)
+
+			if err != nil {
+				return nil, &md, fmt.Errorf("failed to replay column %s: %w", k, err)
+			}
+
+			row[k] = v
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, &md, nil
+}
+
+// normalizedQuery replaces the run UUID in the query by a placeholder, so that queries
+// rendered by different runs of the same pipeline can be matched.
+func normalizedQuery(queryID string, query string) string {
+	if run, _ := ch.ParseQueryID(queryID); len(run) > 0 {
+		query = strings.ReplaceAll(query, run, runPlaceholder)
+	}
+
+	return query
+}
+
+var baseTypes = map[string]reflect.Type{
+	"bool":            reflect.TypeFor[bool](),
+	"string":          reflect.TypeFor[string](),
+	"int":             reflect.TypeFor[int](),
+	"int8":            reflect.TypeFor[int8](),
+	"int16":           reflect.TypeFor[int16](),
+	"int32":           reflect.TypeFor[int32](),
+	"int64":           reflect.TypeFor[int64](),
+	"uint":            reflect.TypeFor[uint](),
+	"uint8":           reflect.TypeFor[uint8](),
+	"uint16":          reflect.TypeFor[uint16](),
+	"uint32":          reflect.TypeFor[uint32](),
+	"uint64":          reflect.TypeFor[uint64](),
+	"float32":         reflect.TypeFor[float32](),
+	"float64":         reflect.TypeFor[float64](),
+	"interface {}":    reflect.TypeFor[any](),
+	"time.Time":       reflect.TypeFor[time.Time](),
+	"uuid.UUID":       reflect.TypeFor[uuid.UUID](),
+	"decimal.Decimal": reflect.TypeFor[decimal.Decimal](),
+	"big.Int":         reflect.TypeFor[big.Int](),
+	"net.IP":          reflect.TypeFor[net.IP](),
+}
+
+// decodeValue decodes a recorded value into the Go type it had when recorded.
+// Values of types it cannot rebuild are decoded as plain JSON values.
+func decodeValue(typeName string, raw json.RawMessage) (any, error) {
+	var typ, err = parseType(typeName)
+
+	if err != nil {
+		typ = reflect.TypeFor[any]()
+	}
+
+	// scanned values are pointers to the column type, never nil themselves even for NULL values
+	if typ.Kind() == reflect.Pointer {
+		var v = reflect.New(typ.Elem())
+
+		if err := unmarshalValue(raw, v); err != nil {
+			return nil, err
+		}
+
+		return v.Interface(), nil
+	}
+
+	var v = reflect.New(typ)
+
+	if err := unmarshalValue(raw, v); err != nil {
+		return nil, err
+	}
+
+	return v.Elem().Interface(), nil
+}
+
+// marshalValue encodes a value as JSON. JSON has no NaN nor infinity, which ClickHouse returns often
+// (e.g. avg over no rows), so non-finite floats are encoded as the strings "NaN", "+Inf" and "-Inf".
+func marshalValue(v any) ([]byte, error) {
+	js, err := json.Marshal(v)
+
+	if _, unsupported := lo.ErrorsAs[*json.UnsupportedValueError](err); unsupported {
+		return json.Marshal(finiteValue(reflect.ValueOf(v)).Interface())
+	}
+
+	return js, err
+}
+
+// finiteValue returns a copy of v where non-finite floats are replaced by their string representation.
+func finiteValue(v reflect.Value) reflect.Value {
+	var anyType = reflect.TypeFor[any]()
+
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return reflect.ValueOf(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			return finiteValue(v.Elem())
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return v
+		}
+
+		var res = reflect.MakeSlice(reflect.SliceOf(anyType), v.Len(), v.Len())
+
+		for i := range v.Len() {
+			res.Index(i).Set(finiteValue(v.Index(i)))
+		}
+
+		return res
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		// keeping the key type keeps keys encoded as they would have been
+		var res = reflect.MakeMapWithSize(reflect.MapOf(v.Type().Key(), anyType), v.Len())
+
+		for iter := v.MapRange(); iter.Next(); {
+			res.SetMapIndex(iter.Key(), finiteValue(iter.Value()))
+		}
+
+		return res
+	}
+
+	return v
+}
+
+// unmarshalValue decodes raw into the value ptr points to, accepting the strings written by marshalValue
+// in place of non-finite floats.
+func unmarshalValue(raw json.RawMessage, ptr reflect.Value) error {
+	if err := json.Unmarshal(raw, ptr.Interface()); err == nil {
+		return nil
+	}
+
+	ptr.Elem().SetZero()
+	return decodeNonFinite(raw, ptr.Elem())
+}
+
+func decodeNonFinite(raw json.RawMessage, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		var s string
+
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return json.Unmarshal(raw, v.Addr().Interface())
+		}
+
+		f, err := strconv.ParseFloat(s, 64)
+
+		if err != nil {
+			return fmt.Errorf("invalid float: %s", s)
+		}
+
+		v.SetFloat(f)
+		return nil
+
+	case reflect.Pointer:
+		if string(raw) == "null" {
+			return nil
+		}
+
+		v.Set(reflect.New(v.Type().Elem()))
+		return decodeNonFinite(raw, v.Elem())
+
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return err
+		}
+
+		if v.Kind() == reflect.Slice {
+			if elems == nil {
+				return nil
+			}
+
+			v.Set(reflect.MakeSlice(v.Type(), len(elems), len(elems)))
+		}
+
+		for i := range min(len(elems), v.Len()) {
+			if err := decodeNonFinite(elems[i], v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case reflect.Map:
+		var elems map[string]json.RawMessage
+
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return err
+		}
+
+		if elems == nil {
+			return nil
+		}
+
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(elems)))
+
+		for k, elem := range elems {
+			var (
+				key = reflect.New(v.Type().Key())
+				val = reflect.New(v.Type().Elem())
+			)
+
+			// string keys are written as is, other keys (e.g. integers) as their JSON encoding
+			if key.Elem().Kind() == reflect.String {
+				key.Elem().SetString(k)
+			} else if err := json.Unmarshal([]byte(k), key.Interface()); err != nil {
+				return err
+			}
+
+			if err := decodeNonFinite(elem, val.Elem()); err != nil {
+				return err
+			}
+
+			v.SetMapIndex(key.Elem(), val.Elem())
+		}
+
+		return nil
+
+	default:
+		return json.Unmarshal(raw, v.Addr().Interface())
+	}
+}
+
+// parseType rebuilds a type from its reflect.Type.String() representation.
+func parseType(name string) (reflect.Type, error) {
+	switch {
+	case len(name) == 0:
+		return nil, fmt.Errorf("empty type name")
+
+	case strings.HasPrefix(name, "*"):
+		elem, err := parseType(name[1:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return reflect.PointerTo(elem), nil
+
+	case strings.HasPrefix(name, "[]"):
+		elem, err := parseType(name[2:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return reflect.SliceOf(elem), nil
+
+	case strings.HasPrefix(name, "["):
+		var end = strings.Index(name, "]")
+
+		if end < 0 {
+			return nil, fmt.Errorf("invalid type name: %s", name)
+		}
+
+		n, err := strconv.Atoi(name[1:end])
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid type name: %s", name)
+		}
+
+		elem, err := parseType(name[end+1:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return reflect.ArrayOf(n, elem), nil
+
+	case strings.HasPrefix(name, "map["):
+		var depth, end = 0, -1
+
+		for i := 3; i < len(name) && end < 0; i++ {
+			switch name[i] {
+			case '[':
+				depth++
+			case ']':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+
+		if end < 0 {
+			return nil, fmt.Errorf("invalid type name: %s", name)
+		}
+
+		key, err := parseType(name[4:end])
+
+		if err != nil {
+			return nil, err
+		}
+
+		elem, err := parseType(name[end+1:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return reflect.MapOf(key, elem), nil
+	}
+
+	if typ, found := baseTypes[name]; found {
+		return typ, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type: %s", name)
+}
@@ -0,0 +1,168 @@
+package record
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestParseType(t *testing.T) {
+	var tests = []struct {
+		name string
+		want reflect.Type
+	}{
+		{"string", reflect.TypeFor[string]()},
+		{"*uint64", reflect.TypeFor[*uint64]()},
+		{"**string", reflect.TypeFor[**string]()},
+		{"[]int32", reflect.TypeFor[[]int32]()},
+		{"[16]uint8", reflect.TypeFor[[16]uint8]()},
+		{"map[string]float64", reflect.TypeFor[map[string]float64]()},
+		{"map[string]map[int64][]string", reflect.TypeFor[map[string]map[int64][]string]()},
+		{"*[]map[string]interface {}", reflect.TypeFor[*[]map[string]any]()},
+		{"*time.Time", reflect.TypeFor[*time.Time]()},
+		{"*decimal.Decimal", reflect.TypeFor[*decimal.Decimal]()},
+	}
+
+	for _, test := range tests {
+		got, err := parseType(test.name)
+
+		if err != nil {
+			t.Errorf("parseType(%q): %v", test.name, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("parseType(%q) = %s, want %s", test.name, got, test.want)
+		}
+
+		if got.String() != test.name {
+			t.Errorf("parseType(%q).String() = %s", test.name, got)
+		}
+	}
+
+	for _, name := range []string{"", "chan int", "[x]int", "map[string", "foo.Bar"} {
+		if _, err := parseType(name); err == nil {
+			t.Errorf("parseType(%q) should fail", name)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestDecodeValueRoundTrip(t *testing.T) {
+	var (
+		ts    = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+		nilID *uuid.UUID
+	)
+
+	var values = []any{
+		ptr("abc"),
+		ptr(uint64(math.MaxUint64)),
+		ptr(int8(-3)),
+		ptr(float32(1.5)),
+		ptr(ptr("nullable")),
+		ptr((*string)(nil)),
+		ptr(ts),
+		ptr(uuid.MustParse("0190d1a4-7b6c-7f00-8000-000000000001")),
+		ptr(&nilID),
+		ptr(decimal.RequireFromString("123.456")),
+		ptr(*big.NewInt(42)),
+		ptr([]string{"a", "b"}),
+		ptr(map[string]uint32{"x": 1}),
+		ptr(map[int64]string{-1: "y"}),
+		ptr([2]int16{1, 2}),
+		ptr(math.NaN()),
+		ptr(math.Inf(1)),
+		ptr(math.Inf(-1)),
+		ptr(ptr(math.Inf(-1))),
+		ptr([]float64{1, math.NaN(), math.Inf(1)}),
+		ptr(map[string]float32{"a": float32(math.Inf(-1)), "b": 2}),
+		ptr(map[int32][]float64{7: {math.Inf(1)}}),
+		ptr([]any{"a", math.NaN()}),
+	}
+
+	for _, v := range values {
+		raw, err := marshalValue(v)
+
+		if err != nil {
+			t.Errorf("marshalValue(%T): %v", v, err)
+			continue
+		}
+
+		got, err := decodeValue(reflect.TypeOf(v).String(), raw)
+
+		if err != nil {
+			t.Errorf("decodeValue(%T, %s): %v", v, raw, err)
+			continue
+		}
+
+		if reflect.TypeOf(got) != reflect.TypeOf(v) {
+			t.Errorf("decodeValue(%T, %s) returned a %T", v, raw, got)
+			continue
+		}
+
+		// NaN is never equal to itself, so values are compared through their encoding
+		again, err := marshalValue(got)
+
+		if err != nil {
+			t.Errorf("marshalValue(%T) after round trip: %v", v, err)
+			continue
+		}
+
+		if string(again) != string(raw) {
+			t.Errorf("%T: round trip %s != %s", v, again, raw)
+		}
+	}
+}
+
+func TestDecodeValueNonFinite(t *testing.T) {
+	got, err := decodeValue("*float64", json.RawMessage(`"NaN"`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := *got.(*float64); !math.IsNaN(f) {
+		t.Errorf("got %v, want NaN", f)
+	}
+
+	got, err = decodeValue("[]float32", json.RawMessage(`[1,"-Inf"]`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fs := got.([]float32); len(fs) != 2 || fs[0] != 1 || !math.IsInf(float64(fs[1]), -1) {
+		t.Errorf("got %v, want [1 -Inf]", fs)
+	}
+
+	if _, err := decodeValue("*float64", json.RawMessage(`"abc"`)); err == nil {
+		t.Errorf("decoding an invalid float should fail")
+	}
+}
+
+func TestNewRecordNonFinite(t *testing.T) {
+	rec, err := newRecord("agt:run:-:-:avg", "SELECT avg(x)", []map[string]any{{"avg": ptr(math.NaN())}}, nil, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, _, err := rec.result()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := *rows[0]["avg"].(*float64); !math.IsNaN(f) {
+		t.Errorf("got %v, want NaN", f)
+	}
+}
@@ -0,0 +1,134 @@
+package record
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+type RecordingEngineConfig struct {
+	// Path is the file records are written to, one JSON record per line.
+	// It is truncated first, so that it only holds the queries of a single run.
+	Path string
+}
+
+// RecordingEngine wraps an engine and records every query it runs, with its rendered SQL, result rows,
+// metadata and error, so that the run can later be reproduced with a ReplayEngine.
+type RecordingEngine struct {
+	conf   RecordingEngineConfig
+	logger *slog.Logger
+	inner  engine.Engine
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+}
+
+func NewRecordingEngine(ctx context.Context, inner engine.Engine, conf RecordingEngineConfig) (*RecordingEngine, error) {
+	if len(conf.Path) == 0 {
+		return nil, fmt.Errorf("recording path must be specified")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(conf.Path), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(conf.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordingEngine{
+		conf:   conf,
+		logger: slogctx.FromCtx(ctx),
+		inner:  inner,
+		file:   f,
+		enc:    json.NewEncoder(f),
+	}, nil
+}
+
+func (eng *RecordingEngine) Start() error {
+	return eng.inner.Start()
+}
+
+func (eng *RecordingEngine) Stop() {
+	eng.inner.Stop()
+}
+
+func (eng *RecordingEngine) Wait() error {
+	var err = eng.inner.Wait()
+
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+
+	if closeErr := eng.file.Close(); closeErr != nil && err == nil {
+		return closeErr
+	}
+
+	return err
+}
+
+func (eng *RecordingEngine) Ping(ctx context.Context) error {
+	return eng.inner.Ping(ctx)
+}
+
+func (eng *RecordingEngine) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	rows, md, err := eng.inner.Query(ctx, query, args...)
+	eng.record(ctx, query, args, rows, md, err)
+	return rows, md, err
+}
+
+// QueryStream streams the query from the wrapped engine; streamed results are not recorded.
+func (eng *RecordingEngine) QueryStream(ctx context.Context, query string, format string, w io.Writer) (*engine.QueryMetadata, error) {
+	eng.logger.Warn("streamed query results are not recorded", "query_id", ch.QueryIDFromContext(ctx))
+	return engine.QueryStream(ctx, eng.inner, query, format, w)
+}
+
+func (eng *RecordingEngine) OpenSession(ctx context.Context, mode engine.SessionMode) (engine.Session, error) {
+	sess, err := engine.OpenSession(ctx, eng.inner, mode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &recordingSession{Session: sess, eng: eng}, nil
+}
+
+// record appends a record for the query; failing to do so is logged rather than failing the query.
+func (eng *RecordingEngine) record(ctx context.Context, query string, args []any, rows []map[string]any, md *engine.QueryMetadata, err error) {
+	if len(args) > 0 {
+		eng.logger.Warn("query arguments are not recorded", "query_id", ch.QueryIDFromContext(ctx))
+	}
+
+	rec, recErr := newRecord(ch.QueryIDFromContext(ctx), query, rows, md, err)
+
+	if recErr == nil {
+		eng.mu.Lock()
+		recErr = eng.enc.Encode(rec)
+		eng.mu.Unlock()
+	}
+
+	if recErr != nil {
+		eng.logger.Error("failed to record query", "query_id", ch.QueryIDFromContext(ctx), "error", recErr.Error())
+	}
+}
+
+type recordingSession struct {
+	engine.Session
+	eng *RecordingEngine
+}
+
+func (s *recordingSession) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	rows, md, err := s.Session.Query(ctx, query, args...)
+	s.eng.record(ctx, query, args, rows, md, err)
+	return rows, md, err
+}
@@ -0,0 +1,50 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
+)
+
+func TestRecordingEngineTruncates(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "records.jsonl")
+
+	// each run records a single query, and the file must only hold the last one
+	for _, query := range []string{"SELECT 1", "SELECT 2"} {
+		inner, err := fake.NewFakeEngine(fake.FakeEngineConfig{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		eng, err := NewRecordingEngine(context.Background(), inner, RecordingEngineConfig{Path: path})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := eng.Query(context.Background(), query); err != nil {
+			t.Fatal(err)
+		}
+
+		eng.Stop()
+
+		if err := eng.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := bytes.Count(content, []byte("\n")); lines != 1 || !bytes.Contains(content, []byte("SELECT 2")) {
+		t.Errorf("got %d record(s), want only the one of the last run:\n%s", lines, content)
+	}
+}
@@ -0,0 +1,165 @@
+package record
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	slogctx "github.com/veqryn/slog-context"
+)
+
+type ReplayEngineConfig struct {
+	// Path is a file written by a RecordingEngine.
+	Path string
+	// MatchTemplate lets a query whose SQL was not recorded be served the next result recorded
+	// for the same template, e.g. when the SQL depends on the current time.
+	MatchTemplate bool
+}
+
+// replayQueue serves the records of a key in order, then keeps serving the last one.
+type replayQueue struct {
+	records []*Record
+	next    int
+}
+
+func (q *replayQueue) pop() *Record {
+	var rec = q.records[min(q.next, len(q.records)-1)]
+	q.next++
+	return rec
+}
+
+// ReplayEngine serves the results recorded by a RecordingEngine instead of running queries.
+// Queries are matched on their SQL, with the run UUID abstracted away, and a query run several times
+// gets the recorded results in the order they were recorded.
+type ReplayEngine struct {
+	conf       ReplayEngineConfig
+	logger     *slog.Logger
+	mu         sync.Mutex
+	byQuery    map[string]*replayQueue
+	byTemplate map[string]*replayQueue
+	stopOnce   sync.Once
+	stopChan   chan struct{}
+}
+
+func NewReplayEngine(ctx context.Context, conf ReplayEngineConfig) (*ReplayEngine, error) {
+	if len(conf.Path) == 0 {
+		return nil, fmt.Errorf("recording path must be specified")
+	}
+
+	f, err := os.Open(conf.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var (
+		eng = ReplayEngine{
+			conf:       conf,
+			logger:     slogctx.FromCtx(ctx),
+			byQuery:    make(map[string]*replayQueue),
+			byTemplate: make(map[string]*replayQueue),
+			stopChan:   make(chan struct{}),
+		}
+		scanner = bufio.NewScanner(f)
+		line    int
+		records int
+	)
+
+	scanner.Buffer(make([]byte, 0, 1024*1024), 1024*1024*1024)
+
+	for scanner.Scan() {
+		line++
+
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var rec Record
+
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("invalid record at %s:%d: %w", conf.Path, line, err)
+		}
+
+		appendRecord(eng.byQuery, normalizedQuery(rec.QueryID, rec.Query), &rec)
+		records++
+
+		if len(rec.Template) > 0 {
+			appendRecord(eng.byTemplate, rec.Template, &rec)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	eng.logger.Info("loaded recording", "path", conf.Path, "records", records)
+	return &eng, nil
+}
+
+func appendRecord(queues map[string]*replayQueue, key string, rec *Record) {
+	if queues[key] == nil {
+		queues[key] = &replayQueue{}
+	}
+
+	queues[key].records = append(queues[key].records, rec)
+}
+
+func (eng *ReplayEngine) Start() error {
+	return nil
+}
+
+func (eng *ReplayEngine) Stop() {
+	eng.stopOnce.Do(func() { close(eng.stopChan) })
+}
+
+func (eng *ReplayEngine) Wait() error {
+	<-eng.stopChan
+	return nil
+}
+
+func (eng *ReplayEngine) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (eng *ReplayEngine) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	var (
+		queryID     = ch.QueryIDFromContext(ctx)
+		_, template = ch.ParseQueryID(queryID)
+	)
+
+	eng.mu.Lock()
+	defer eng.mu.Unlock()
+
+	if q, found := eng.byQuery[normalizedQuery(queryID, query)]; found {
+		return q.pop().result()
+	}
+
+	if q, found := eng.byTemplate[template]; found && eng.conf.MatchTemplate {
+		eng.logger.Debug("replaying result recorded for another query of the same template", "query_id", queryID)
+		return q.pop().result()
+	}
+
+	return nil, &engine.QueryMetadata{}, fmt.Errorf("no recorded result for query %s", queryID)
+}
+
+// OpenSession returns the engine itself, since recorded results do not depend on sessions.
+func (eng *ReplayEngine) OpenSession(ctx context.Context, mode engine.SessionMode) (engine.Session, error) {
+	return replaySession{eng}, nil
+}
+
+type replaySession struct {
+	*ReplayEngine
+}
+
+func (s replaySession) Close() error {
+	return nil
+}
@@ -14,19 +14,32 @@ import (
 )
 
 type RemoteEngineConfig struct {
-	Dsn      string
-	Settings map[string]any
-	Logging  ch.LogHandlerConfig
+	Dsn           string
+	Settings      map[string]any
+	Logging       ch.LogHandlerConfig
+	ProfileEvents []string
 }
 
 type RemoteEngine struct {
-	conf     RemoteEngineConfig
-	logger   *slog.Logger
-	stopChan chan interface{}
-	conn     driver.Conn
+	conf      RemoteEngineConfig
+	logger    *slog.Logger
+	logFilter *ch.LogFilter
+	stopChan  chan interface{}
+	chopts    *clickhouse.Options
+	conn      driver.Conn
 }
 
 func NewRemoteEngine(ctx context.Context, conf RemoteEngineConfig) (*RemoteEngine, error) {
+	if len(conf.ProfileEvents) == 0 {
+		conf.ProfileEvents = ch.DefaultProfileEvents
+	}
+
+	logFilter, err := ch.NewLogFilter(conf.Logging)
+
+	if err != nil {
+		return nil, err
+	}
+
 	chopts, err := clickhouse.ParseDSN(conf.Dsn)
 
 	if err != nil {
@@ -41,10 +54,12 @@ func NewRemoteEngine(ctx context.Context, conf RemoteEngineConfig) (*RemoteEngin
 	}
 
 	return &RemoteEngine{
-		conf:     conf,
-		logger:   slogctx.FromCtx(ctx),
-		stopChan: make(chan interface{}, 1),
-		conn:     chconn,
+		conf:      conf,
+		logger:    slogctx.FromCtx(ctx),
+		logFilter: logFilter,
+		stopChan:  make(chan interface{}, 1),
+		chopts:    chopts,
+		conn:      chconn,
 	}, nil
 }
 
@@ -67,13 +82,28 @@ func (eng *RemoteEngine) Ping(ctx context.Context) error {
 }
 
 func (eng *RemoteEngine) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	return eng.query(ctx, eng.conn, query, args...)
+}
+
+func (eng *RemoteEngine) OpenSession(ctx context.Context, mode engine.SessionMode) (engine.Session, error) {
+	conn, err := ch.OpenSessionConn(*eng.chopts, mode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteSession{eng: eng, conn: conn}, nil
+}
+
+func (eng *RemoteEngine) query(ctx context.Context, conn driver.Conn, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
 	var md engine.QueryMetadata
 
-	rows, err := eng.conn.Query(
+	rows, err := conn.Query(
 		clickhouse.Context(
 			ctx,
 			clickhouse.WithProgress(ch.ProgressHandler(&md)),
-			clickhouse.WithLogs(ch.LogHandler(eng.logger, eng.conf.Logging)),
+			clickhouse.WithLogs(ch.LogHandler(slogctx.FromCtx(ctx), eng.logFilter)),
+			clickhouse.WithProfileEvents(ch.ProfileEventHandler(&md, eng.conf.ProfileEvents)),
 		),
 		query,
 		args...,
@@ -87,6 +117,20 @@ func (eng *RemoteEngine) Query(ctx context.Context, query string, args ...any) (
 		return nil, &md, err
 	}
 
+	md.Columns = rows.Columns()
 	res, err := ch.RowsToMaps(rows)
 	return res, &md, err
 }
+
+type remoteSession struct {
+	eng  *RemoteEngine
+	conn driver.Conn
+}
+
+func (s *remoteSession) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	return s.eng.query(ctx, s.conn, query, args...)
+}
+
+func (s *remoteSession) Close() error {
+	return s.conn.Close()
+}
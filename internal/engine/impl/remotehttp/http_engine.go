@@ -0,0 +1,386 @@
+package remotehttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	chproto "github.com/ClickHouse/ch-go/proto"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/google/uuid"
+	slogctx "github.com/veqryn/slog-context"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+type HTTPEngineConfig struct {
+	URL                string
+	User               string
+	Password           string
+	Database           string
+	Settings           map[string]any
+	Headers            map[string]string
+	ProxyURL           string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	// Compression gzips request bodies and asks the server to gzip responses.
+	Compression bool
+}
+
+// HTTPEngine runs queries against a remote server through the HTTP(S) interface.
+// Results are requested in the Native format, so rows are scanned into the same types as with RemoteEngine.
+type HTTPEngine struct {
+	conf     HTTPEngineConfig
+	logger   *slog.Logger
+	url      *url.URL
+	client   *http.Client
+	stopOnce sync.Once
+	stopChan chan interface{}
+}
+
+func NewHTTPEngine(ctx context.Context, conf HTTPEngineConfig) (*HTTPEngine, error) {
+	u, err := url.Parse(conf.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("HTTP engine URL must use the http or https scheme: %s", conf.URL)
+	}
+
+	var transport = http.DefaultTransport.(*http.Transport).Clone()
+
+	if len(conf.ProxyURL) > 0 {
+		proxyURL, err := url.Parse(conf.ProxyURL)
+
+		if err != nil {
+			return nil, err
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if conf.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &HTTPEngine{
+		conf:     conf,
+		logger:   slogctx.FromCtx(ctx),
+		url:      u,
+		client:   &http.Client{Transport: transport, Timeout: conf.Timeout},
+		stopChan: make(chan interface{}, 1),
+	}, nil
+}
+
+func (eng *HTTPEngine) Start() error {
+	return nil
+}
+
+func (eng *HTTPEngine) Stop() {
+	eng.stopOnce.Do(func() {
+		eng.client.CloseIdleConnections()
+		close(eng.stopChan)
+	})
+}
+
+func (eng *HTTPEngine) Wait() error {
+	<-eng.stopChan
+	return nil
+}
+
+func (eng *HTTPEngine) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, eng.url.JoinPath("ping").String(), nil)
+
+	if err != nil {
+		return err
+	}
+
+	resp, err := eng.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping failed: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (eng *HTTPEngine) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	return eng.query(ctx, "", query, args...)
+}
+
+// OpenSession names a session with a session_id; both session modes are equivalent over HTTP.
+func (eng *HTTPEngine) OpenSession(ctx context.Context, mode engine.SessionMode) (engine.Session, error) {
+	return &httpSession{eng: eng, id: "agt-" + uuid.NewString()}, nil
+}
+
+func (eng *HTTPEngine) query(ctx context.Context, sessionID string, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	var (
+		md = engine.QueryMetadata{}
+		t0 = time.Now()
+	)
+
+	if len(args) > 0 {
+		return nil, &md, fmt.Errorf("query arguments are not supported by the HTTP engine")
+	}
+
+	req, err := eng.newRequest(ctx, sessionID, query, "Native")
+
+	if err != nil {
+		return nil, &md, err
+	}
+
+	resp, err := eng.client.Do(req)
+
+	if err != nil {
+		return nil, &md, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &md, readException(resp)
+	}
+
+	if err := parseMetadataHeaders(resp.Header, &md); err != nil {
+		slogctx.FromCtx(ctx).Warn("failed to parse query metadata headers", "error", err.Error())
+	}
+
+	if md.Elapsed == 0 {
+		md.Elapsed = time.Since(t0)
+	}
+
+	var (
+		reader = chproto.NewReader(resp.Body)
+		res    []map[string]any
+	)
+
+	for {
+		var block proto.Block
+
+		if err := block.Decode(reader, 0); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, &md, err
+		}
+
+		if md.Columns == nil {
+			md.Columns = block.ColumnsNames()
+		}
+
+		rows, err := ch.BlockToMaps(&block)
+
+		if err != nil {
+			return nil, &md, err
+		}
+
+		res = append(res, rows...)
+	}
+
+	return res, &md, nil
+}
+
+// QueryStream copies the response body, in the given format, to w.
+func (eng *HTTPEngine) QueryStream(ctx context.Context, query string, format string, w io.Writer) (*engine.QueryMetadata, error) {
+	var (
+		md = engine.QueryMetadata{}
+		t0 = time.Now()
+	)
+
+	req, err := eng.newRequest(ctx, "", query, format)
+
+	if err != nil {
+		return &md, err
+	}
+
+	resp, err := eng.client.Do(req)
+
+	if err != nil {
+		return &md, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &md, readException(resp)
+	}
+
+	if err := parseMetadataHeaders(resp.Header, &md); err != nil {
+		slogctx.FromCtx(ctx).Warn("failed to parse query metadata headers", "error", err.Error())
+	}
+
+	_, err = io.Copy(w, resp.Body)
+
+	if md.Elapsed == 0 {
+		md.Elapsed = time.Since(t0)
+	}
+
+	return &md, err
+}
+
+func (eng *HTTPEngine) newRequest(ctx context.Context, sessionID string, query string, format string) (*http.Request, error) {
+	var (
+		u      = *eng.url
+		params = u.Query()
+		body   io.Reader
+	)
+
+	for k, v := range ch.NormalizeSettings(eng.conf.Settings) {
+		params.Set(k, fmt.Sprint(v))
+	}
+
+	for k, v := range ch.SettingsFromContext(ctx) {
+		params.Set(k, fmt.Sprint(v))
+	}
+
+	params.Set("default_format", format)
+	params.Set("send_progress_in_http_headers", "1")
+	// the server buffers the result, so that an exception raised while it runs is returned with an error
+	// status instead of being appended to a 200 response, and the summary header covers the whole query
+	params.Set("wait_end_of_query", "1")
+
+	if eng.conf.Compression {
+		params.Set("enable_http_compression", "1")
+	}
+
+	if len(eng.conf.Database) > 0 {
+		params.Set("database", eng.conf.Database)
+	}
+
+	if queryID := ch.QueryIDFromContext(ctx); len(queryID) > 0 {
+		params.Set("query_id", queryID)
+	}
+
+	if len(sessionID) > 0 {
+		params.Set("session_id", sessionID)
+	}
+
+	u.RawQuery = params.Encode()
+
+	if eng.conf.Compression {
+		var buf bytes.Buffer
+		var w = gzip.NewWriter(&buf)
+
+		if _, err := w.Write([]byte(query)); err != nil {
+			return nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		body = &buf
+	} else {
+		body = strings.NewReader(query)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if eng.conf.Compression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	if len(eng.conf.User) > 0 {
+		req.Header.Set("X-ClickHouse-User", eng.conf.User)
+		req.Header.Set("X-ClickHouse-Key", eng.conf.Password)
+	}
+
+	for k, v := range eng.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, nil
+}
+
+func readException(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var ex = proto.Exception{Message: strings.TrimSpace(string(body))}
+
+	if code, err := strconv.ParseInt(resp.Header.Get("X-ClickHouse-Exception-Code"), 10, 32); err == nil {
+		ex.Code = int32(code)
+	}
+
+	if len(ex.Message) == 0 {
+		ex.Message = resp.Status
+	}
+
+	return &ex
+}
+
+// parseMetadataHeaders fills md from the X-ClickHouse-Summary header, or from the last
+// X-ClickHouse-Progress header when the summary is missing.
+func parseMetadataHeaders(header http.Header, md *engine.QueryMetadata) error {
+	var raw = header.Get("X-ClickHouse-Summary")
+
+	if len(raw) == 0 {
+		if progress := header.Values("X-ClickHouse-Progress"); len(progress) > 0 {
+			raw = progress[len(progress)-1]
+		}
+	}
+
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var summary map[string]string
+
+	if err := json.Unmarshal([]byte(raw), &summary); err != nil {
+		return err
+	}
+
+	var get = func(key string) uint64 {
+		v, _ := strconv.ParseUint(summary[key], 10, 64)
+		return v
+	}
+
+	md.Rows = get("read_rows")
+	md.Bytes = get("read_bytes")
+	md.TotalRows = get("total_rows_to_read")
+	md.WroteRows = get("written_rows")
+	md.WroteBytes = get("written_bytes")
+	md.Elapsed = time.Duration(get("elapsed_ns"))
+	md.MemoryPeakUsage = max(get("memory_usage"), get("peak_memory_usage"))
+	return nil
+}
+
+type httpSession struct {
+	eng *HTTPEngine
+	id  string
+}
+
+func (s *httpSession) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	return s.eng.query(ctx, s.id, query, args...)
+}
+
+func (s *httpSession) Close() error {
+	return nil
+}
@@ -0,0 +1,173 @@
+package remotehttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/agnosticeng/agt/internal/engine"
+)
+
+func TestParseMetadataHeaders(t *testing.T) {
+	var tests = []struct {
+		name    string
+		header  http.Header
+		want    engine.QueryMetadata
+		wantErr bool
+	}{
+		{
+			name:   "no header",
+			header: http.Header{},
+		},
+		{
+			name: "summary",
+			header: http.Header{"X-Clickhouse-Summary": {
+				`{"read_rows":"10","read_bytes":"80","written_rows":"2","written_bytes":"16","total_rows_to_read":"12","elapsed_ns":"1500000","memory_usage":"100","peak_memory_usage":"4096"}`,
+			}},
+			want: engine.QueryMetadata{
+				Rows:            10,
+				Bytes:           80,
+				TotalRows:       12,
+				WroteRows:       2,
+				WroteBytes:      16,
+				Elapsed:         1500 * time.Microsecond,
+				MemoryPeakUsage: 4096,
+			},
+		},
+		{
+			name: "summary wins over progress",
+			header: http.Header{
+				"X-Clickhouse-Summary":  {`{"read_rows":"10"}`},
+				"X-Clickhouse-Progress": {`{"read_rows":"5"}`},
+			},
+			want: engine.QueryMetadata{Rows: 10},
+		},
+		{
+			name:   "last progress",
+			header: http.Header{"X-Clickhouse-Progress": {`{"read_rows":"1"}`, `{"read_rows":"5","memory_usage":"64"}`}},
+			want:   engine.QueryMetadata{Rows: 5, MemoryPeakUsage: 64},
+		},
+		{
+			name:   "unparsable values are zero",
+			header: http.Header{"X-Clickhouse-Summary": {`{"read_rows":"-1","read_bytes":"x"}`}},
+		},
+		{
+			name:    "invalid JSON",
+			header:  http.Header{"X-Clickhouse-Summary": {`{"read_rows":10}`}},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		var (
+			md  engine.QueryMetadata
+			err = parseMetadataHeaders(test.header, &md)
+		)
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: parseMetadataHeaders() error = %v, want error %t", test.name, err, test.wantErr)
+			continue
+		}
+
+		if test.wantErr {
+			continue
+		}
+
+		if md.Rows != test.want.Rows || md.Bytes != test.want.Bytes || md.TotalRows != test.want.TotalRows ||
+			md.WroteRows != test.want.WroteRows || md.WroteBytes != test.want.WroteBytes ||
+			md.Elapsed != test.want.Elapsed || md.MemoryPeakUsage != test.want.MemoryPeakUsage {
+			t.Errorf("%s: parseMetadataHeaders() = %+v, want %+v", test.name, md, test.want)
+		}
+	}
+}
+
+func TestQueryStream(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params = r.URL.Query()
+
+		if params.Get("wait_end_of_query") != "1" {
+			t.Errorf("streamed queries should wait for the end of the query")
+		}
+
+		if params.Get("default_format") != "CSV" {
+			t.Errorf("got format %s, want CSV", params.Get("default_format"))
+		}
+
+		if query, _ := io.ReadAll(r.Body); string(query) == "fail" {
+			w.Header().Set("X-ClickHouse-Exception-Code", "395")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Code: 395. DB::Exception: failed\n"))
+			return
+		}
+
+		w.Header().Set("X-ClickHouse-Summary", `{"read_rows":"2"}`)
+		w.Write([]byte("1\n2\n"))
+	}))
+
+	defer server.Close()
+
+	eng, err := NewHTTPEngine(context.Background(), HTTPEngineConfig{URL: server.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	md, err := eng.QueryStream(context.Background(), "ok", "CSV", &buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "1\n2\n" || md.Rows != 2 {
+		t.Errorf("got %q and %d rows read", buf.String(), md.Rows)
+	}
+
+	buf.Reset()
+
+	var exception *proto.Exception
+
+	if _, err := eng.QueryStream(context.Background(), "fail", "CSV", &buf); !errors.As(err, &exception) || exception.Code != 395 {
+		t.Errorf("QueryStream() error = %v, want exception 395", err)
+	}
+
+	if buf.Len() > 0 {
+		t.Errorf("the exception should not be written to the output: %q", buf.String())
+	}
+}
+
+func TestQueryException(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only reports an exception raised while sending the result with an error status
+		// when it waits for the end of the query, otherwise it appends it to a 200 response
+		if r.URL.Query().Get("wait_end_of_query") != "1" {
+			w.Write([]byte("Code: 395. DB::Exception: failed\n"))
+			return
+		}
+
+		w.Header().Set("X-ClickHouse-Exception-Code", "395")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Code: 395. DB::Exception: failed\n"))
+	}))
+
+	defer server.Close()
+
+	eng, err := NewHTTPEngine(context.Background(), HTTPEngineConfig{URL: server.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var exception *proto.Exception
+
+	if _, _, err := eng.Query(context.Background(), "fail"); !errors.As(err, &exception) || exception.Code != 395 {
+		t.Errorf("Query() error = %v, want exception 395", err)
+	}
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+)
+
+// SessionMode selects how a pipeline component runs its queries in a session. Sessions are not free:
+// the native engines cannot reserve a connection of their pool, so each session opens a driver pool of its own,
+// with a new TCP connection and handshake, and closes it at the end of the session.
+type SessionMode string
+
+var (
+	// SessionConnection runs the queries of a session on a single dedicated connection.
+	SessionConnection SessionMode = "CONNECTION"
+	// SessionID additionally names the session with a session_id, as the HTTP interface requires.
+	SessionID SessionMode = "SESSION_ID"
+)
+
+// Session runs queries in a single ClickHouse session, so that session state such as temporary tables
+// created by one query is visible to the next ones.
+type Session interface {
+	Query(ctx context.Context, query string, args ...any) ([]map[string]any, *QueryMetadata, error)
+	Close() error
+}
+
+// SessionOpener is implemented by engines able to open sessions.
+type SessionOpener interface {
+	OpenSession(ctx context.Context, mode SessionMode) (Session, error)
+}
+
+func OpenSession(ctx context.Context, eng Engine, mode SessionMode) (Session, error) {
+	switch mode {
+	case SessionConnection, SessionID:
+	default:
+		return nil, fmt.Errorf("unknown session mode: %s", mode)
+	}
+
+	opener, ok := eng.(SessionOpener)
+
+	if !ok {
+		return nil, fmt.Errorf("engine does not support sessions")
+	}
+
+	return opener.OpenSession(ctx, mode)
+}
@@ -0,0 +1,23 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Streamer is implemented by engines able to write the result of a query in a ClickHouse output format
+// (e.g. CSVWithNames, Parquet) as it is produced, instead of decoding it into rows.
+type Streamer interface {
+	QueryStream(ctx context.Context, query string, format string, w io.Writer) (*QueryMetadata, error)
+}
+
+func QueryStream(ctx context.Context, eng Engine, query string, format string, w io.Writer) (*QueryMetadata, error) {
+	streamer, ok := eng.(Streamer)
+
+	if !ok {
+		return &QueryMetadata{}, fmt.Errorf("engine does not support streaming output formats")
+	}
+
+	return streamer.QueryStream(ctx, query, format, w)
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/uber-go/tally/v4"
+)
+
+// cachedReporter adapts a tally.StatsReporter to the tally.CachedStatsReporter interface,
+// so that it can be combined with the Prometheus reporter in a single root scope.
+type cachedReporter struct {
+	tally.StatsReporter
+}
+
+func newCachedReporter(r tally.StatsReporter) tally.CachedStatsReporter {
+	return &cachedReporter{StatsReporter: r}
+}
+
+func (r *cachedReporter) AllocateCounter(name string, tags map[string]string) tally.CachedCount {
+	return cachedMetric{r: r.StatsReporter, name: name, tags: tags}
+}
+
+func (r *cachedReporter) AllocateGauge(name string, tags map[string]string) tally.CachedGauge {
+	return cachedMetric{r: r.StatsReporter, name: name, tags: tags}
+}
+
+func (r *cachedReporter) AllocateTimer(name string, tags map[string]string) tally.CachedTimer {
+	return cachedMetric{r: r.StatsReporter, name: name, tags: tags}
+}
+
+func (r *cachedReporter) AllocateHistogram(name string, tags map[string]string, buckets tally.Buckets) tally.CachedHistogram {
+	return cachedHistogram{cachedMetric: cachedMetric{r: r.StatsReporter, name: name, tags: tags}, buckets: buckets}
+}
+
+type cachedMetric struct {
+	r    tally.StatsReporter
+	name string
+	tags map[string]string
+}
+
+func (m cachedMetric) ReportCount(value int64) {
+	m.r.ReportCounter(m.name, m.tags, value)
+}
+
+func (m cachedMetric) ReportGauge(value float64) {
+	m.r.ReportGauge(m.name, m.tags, value)
+}
+
+func (m cachedMetric) ReportTimer(interval time.Duration) {
+	m.r.ReportTimer(m.name, m.tags, interval)
+}
+
+type cachedHistogram struct {
+	cachedMetric
+	buckets tally.Buckets
+}
+
+func (h cachedHistogram) ValueBucket(lower float64, upper float64) tally.CachedHistogramBucket {
+	return cachedHistogramBucket(func(samples int64) {
+		h.r.ReportHistogramValueSamples(h.name, h.tags, h.buckets, lower, upper, samples)
+	})
+}
+
+func (h cachedHistogram) DurationBucket(lower time.Duration, upper time.Duration) tally.CachedHistogramBucket {
+	return cachedHistogramBucket(func(samples int64) {
+		h.r.ReportHistogramDurationSamples(h.name, h.tags, h.buckets, lower, upper, samples)
+	})
+}
+
+type cachedHistogramBucket func(samples int64)
+
+func (b cachedHistogramBucket) ReportSamples(samples int64) {
+	b(samples)
+}
@@ -0,0 +1,250 @@
+package metrics
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"math"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/agnosticeng/objstr"
+	objstrutils "github.com/agnosticeng/objstr/utils"
+	"github.com/uber-go/tally/v4"
+)
+
+type DumpConfig struct {
+	URL    string
+	Pretty bool
+}
+
+type CounterDump struct {
+	Name  string            `json:"name"`
+	Tags  map[string]string `json:"tags,omitempty"`
+	Value int64             `json:"value"`
+}
+
+type GaugeDump struct {
+	Name  string            `json:"name"`
+	Tags  map[string]string `json:"tags,omitempty"`
+	Value float64           `json:"value"`
+}
+
+type TimerDump struct {
+	Name  string            `json:"name"`
+	Tags  map[string]string `json:"tags,omitempty"`
+	Count int64             `json:"count"`
+	Sum   time.Duration     `json:"sum"`
+	Min   time.Duration     `json:"min"`
+	Max   time.Duration     `json:"max"`
+}
+
+type HistogramBucketDump struct {
+	UpperBound float64 `json:"upper_bound"`
+	Count      int64   `json:"count"`
+}
+
+type HistogramDump struct {
+	Name    string                `json:"name"`
+	Tags    map[string]string     `json:"tags,omitempty"`
+	Buckets []HistogramBucketDump `json:"buckets"`
+}
+
+type Dump struct {
+	Time       time.Time       `json:"time"`
+	Counters   []CounterDump   `json:"counters"`
+	Gauges     []GaugeDump     `json:"gauges"`
+	Timers     []TimerDump     `json:"timers"`
+	Histograms []HistogramDump `json:"histograms"`
+}
+
+// dumpReporter keeps the cumulative value of every metric in memory so that
+// it can be written out as a single JSON document at the end of a run.
+type dumpReporter struct {
+	mu         sync.Mutex
+	counters   map[string]*CounterDump
+	gauges     map[string]*GaugeDump
+	timers     map[string]*TimerDump
+	histograms map[string]*HistogramDump
+}
+
+func newDumpReporter() *dumpReporter {
+	return &dumpReporter{
+		counters:   make(map[string]*CounterDump),
+		gauges:     make(map[string]*GaugeDump),
+		timers:     make(map[string]*TimerDump),
+		histograms: make(map[string]*HistogramDump),
+	}
+}
+
+func (r *dumpReporter) ReportCounter(name string, tags map[string]string, value int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var key = tally.KeyForPrefixedStringMap(name, tags)
+
+	if _, found := r.counters[key]; !found {
+		r.counters[key] = &CounterDump{Name: name, Tags: tags}
+	}
+
+	r.counters[key].Value += value
+}
+
+func (r *dumpReporter) ReportGauge(name string, tags map[string]string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.gauges[tally.KeyForPrefixedStringMap(name, tags)] = &GaugeDump{Name: name, Tags: tags, Value: value}
+}
+
+func (r *dumpReporter) ReportTimer(name string, tags map[string]string, interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var key = tally.KeyForPrefixedStringMap(name, tags)
+
+	t, found := r.timers[key]
+
+	if !found {
+		t = &TimerDump{Name: name, Tags: tags, Min: interval, Max: interval}
+		r.timers[key] = t
+	}
+
+	t.Count++
+	t.Sum += interval
+	t.Min = min(t.Min, interval)
+	t.Max = max(t.Max, interval)
+}
+
+func (r *dumpReporter) ReportHistogramValueSamples(
+	name string,
+	tags map[string]string,
+	buckets tally.Buckets,
+	bucketLowerBound float64,
+	bucketUpperBound float64,
+	samples int64,
+) {
+	r.reportHistogramSamples(name, tags, bucketUpperBound, samples)
+}
+
+func (r *dumpReporter) ReportHistogramDurationSamples(
+	name string,
+	tags map[string]string,
+	buckets tally.Buckets,
+	bucketLowerBound time.Duration,
+	bucketUpperBound time.Duration,
+	samples int64,
+) {
+	var upper = bucketUpperBound.Seconds()
+
+	if bucketUpperBound == math.MaxInt64 {
+		upper = math.MaxFloat64
+	}
+
+	r.reportHistogramSamples(name, tags, upper, samples)
+}
+
+func (r *dumpReporter) reportHistogramSamples(name string, tags map[string]string, upper float64, samples int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var key = tally.KeyForPrefixedStringMap(name, tags)
+
+	h, found := r.histograms[key]
+
+	if !found {
+		h = &HistogramDump{Name: name, Tags: tags}
+		r.histograms[key] = h
+	}
+
+	for i := range h.Buckets {
+		if h.Buckets[i].UpperBound == upper {
+			h.Buckets[i].Count += samples
+			return
+		}
+	}
+
+	h.Buckets = append(h.Buckets, HistogramBucketDump{UpperBound: upper, Count: samples})
+	slices.SortFunc(h.Buckets, func(a, b HistogramBucketDump) int { return cmp.Compare(a.UpperBound, b.UpperBound) })
+}
+
+func (r *dumpReporter) Capabilities() tally.Capabilities {
+	return r
+}
+
+func (r *dumpReporter) Reporting() bool {
+	return true
+}
+
+func (r *dumpReporter) Tagging() bool {
+	return true
+}
+
+func (r *dumpReporter) Flush() {}
+
+func (r *dumpReporter) Dump() Dump {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var d = Dump{Time: time.Now().UTC()}
+
+	for _, c := range r.counters {
+		d.Counters = append(d.Counters, *c)
+	}
+
+	for _, g := range r.gauges {
+		d.Gauges = append(d.Gauges, *g)
+	}
+
+	for _, t := range r.timers {
+		d.Timers = append(d.Timers, *t)
+	}
+
+	for _, h := range r.histograms {
+		d.Histograms = append(d.Histograms, *h)
+	}
+
+	slices.SortFunc(d.Counters, func(a, b CounterDump) int { return cmp.Compare(a.Name, b.Name) })
+	slices.SortFunc(d.Gauges, func(a, b GaugeDump) int { return cmp.Compare(a.Name, b.Name) })
+	slices.SortFunc(d.Timers, func(a, b TimerDump) int { return cmp.Compare(a.Name, b.Name) })
+	slices.SortFunc(d.Histograms, func(a, b HistogramDump) int { return cmp.Compare(a.Name, b.Name) })
+	return d
+}
+
+func (r *dumpReporter) Write(ctx context.Context, conf DumpConfig) error {
+	var (
+		data []byte
+		err  error
+	)
+
+	if conf.Pretty {
+		data, err = json.MarshalIndent(r.Dump(), "", "    ")
+	} else {
+		data, err = json.Marshal(r.Dump())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(conf.URL)
+
+	if err != nil {
+		return err
+	}
+
+	if len(u.Scheme) == 0 {
+		path, err := filepath.Abs(u.Path)
+
+		if err != nil {
+			return err
+		}
+
+		u = &url.URL{Scheme: "file", Path: path}
+	}
+
+	return objstrutils.CreateObject(ctx, objstr.FromContextOrDefault(ctx), u, data)
+}
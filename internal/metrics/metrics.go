@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/uber-go/tally/v4"
+	"github.com/uber-go/tally/v4/multi"
+	promreporter "github.com/uber-go/tally/v4/prometheus"
+	slogctx "github.com/veqryn/slog-context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+type PushGatewayConfig struct {
+	URL string
+	Job string
+}
+
+type PrometheusConfig struct {
+	Disable     bool
+	PushGateway *PushGatewayConfig
+}
+
+type OtlpConfig struct {
+	Endpoint    string
+	EndpointURL string
+	Insecure    bool
+	Headers     map[string]string
+	Interval    time.Duration
+}
+
+type MetricsConfig struct {
+	Prefix         string
+	ReportInterval time.Duration
+	Prometheus     PrometheusConfig
+	StatsD         *StatsDConfig
+	Otlp           *OtlpConfig
+	Dump           *DumpConfig
+}
+
+func (conf MetricsConfig) WithDefaults() MetricsConfig {
+	if len(conf.Prefix) == 0 {
+		conf.Prefix = "agt"
+	}
+
+	if conf.ReportInterval == 0 {
+		conf.ReportInterval = time.Second
+	}
+
+	if conf.Prometheus.PushGateway != nil && len(conf.Prometheus.PushGateway.Job) == 0 {
+		conf.Prometheus.PushGateway.Job = "agt"
+	}
+
+	if conf.Otlp != nil && conf.Otlp.Interval == 0 {
+		conf.Otlp.Interval = 10 * time.Second
+	}
+
+	return conf
+}
+
+// Metrics is the root metrics scope of a run along with the reporters it feeds.
+type Metrics struct {
+	Scope tally.Scope
+	// Handler serves the Prometheus pull endpoint; nil when Prometheus is disabled.
+	Handler http.Handler
+
+	conf        MetricsConfig
+	scopeCloser io.Closer
+	dump        *dumpReporter
+	otlp        *sdkmetric.MeterProvider
+	statsd      io.Closer
+}
+
+// Setup builds a root scope reporting to every configured backend.
+// Close must be called before exiting so that push-based backends receive the final values.
+func Setup(ctx context.Context, conf MetricsConfig) (*Metrics, error) {
+	var (
+		logger    = slogctx.FromCtx(ctx)
+		m         = &Metrics{conf: conf.WithDefaults()}
+		reporters []tally.CachedStatsReporter
+	)
+
+	conf = m.conf
+
+	if !conf.Prometheus.Disable {
+		reporters = append(reporters, promreporter.NewReporter(promreporter.Options{
+			OnRegisterError: func(err error) {
+				logger.Log(ctx, -30, "failed to register metric", "error", err.Error())
+			},
+		}))
+
+		m.Handler = promhttp.Handler()
+	}
+
+	if conf.StatsD != nil {
+		r, client, err := newStatsDReporter(*conf.StatsD)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reporters = append(reporters, newCachedReporter(r))
+		m.statsd = client
+	}
+
+	if conf.Otlp != nil {
+		var opts []otlpmetrichttp.Option
+
+		if len(conf.Otlp.Endpoint) > 0 {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(conf.Otlp.Endpoint))
+		}
+
+		if len(conf.Otlp.EndpointURL) > 0 {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(conf.Otlp.EndpointURL))
+		}
+
+		if conf.Otlp.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+
+		if len(conf.Otlp.Headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(conf.Otlp.Headers))
+		}
+
+		exp, err := otlpmetrichttp.New(ctx, opts...)
+
+		if err != nil {
+			m.closeClients(ctx)
+			return nil, err
+		}
+
+		m.otlp = sdkmetric.NewMeterProvider(
+			sdkmetric.WithResource(resource.NewSchemaless(attribute.String("service.name", conf.Prefix))),
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp, sdkmetric.WithInterval(conf.Otlp.Interval))),
+		)
+
+		reporters = append(reporters, newCachedReporter(newOtlpReporter(m.otlp.Meter("github.com/agnosticeng/agt"))))
+	}
+
+	if conf.Dump != nil {
+		m.dump = newDumpReporter()
+		reporters = append(reporters, newCachedReporter(m.dump))
+	}
+
+	var opts = tally.ScopeOptions{
+		Prefix:    conf.Prefix,
+		Separator: promreporter.DefaultSeparator,
+	}
+
+	switch len(reporters) {
+	case 0:
+	case 1:
+		opts.CachedReporter = reporters[0]
+	default:
+		opts.CachedReporter = multi.NewMultiCachedReporter(reporters...)
+	}
+
+	m.Scope, m.scopeCloser = tally.NewRootScope(opts, conf.ReportInterval)
+	return m, nil
+}
+
+// Close reports the final values and flushes every push-based backend.
+func (m *Metrics) Close(ctx context.Context) error {
+	var errs []error
+
+	if err := m.scopeCloser.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if gw := m.conf.Prometheus.PushGateway; !m.conf.Prometheus.Disable && gw != nil {
+		if err := push.New(gw.URL, gw.Job).Gatherer(prometheus.DefaultGatherer).PushContext(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if m.dump != nil {
+		if err := m.dump.Write(ctx, *m.conf.Dump); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	errs = append(errs, m.closeClients(ctx))
+	return errors.Join(errs...)
+}
+
+func (m *Metrics) closeClients(ctx context.Context) error {
+	var errs []error
+
+	if m.otlp != nil {
+		if err := m.otlp.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if m.statsd != nil {
+		if err := m.statsd.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
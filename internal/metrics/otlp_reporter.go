@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// otlpReporter forwards tally metrics to an OpenTelemetry meter.
+// Tally histograms only report bucket counts, so samples are recorded at their bucket upper bound
+// (or lower bound for the overflow bucket).
+type otlpReporter struct {
+	meter      metric.Meter
+	mu         sync.Mutex
+	counters   map[string]metric.Int64Counter
+	gauges     map[string]metric.Float64Gauge
+	histograms map[string]metric.Float64Histogram
+}
+
+func newOtlpReporter(meter metric.Meter) *otlpReporter {
+	return &otlpReporter{
+		meter:      meter,
+		counters:   make(map[string]metric.Int64Counter),
+		gauges:     make(map[string]metric.Float64Gauge),
+		histograms: make(map[string]metric.Float64Histogram),
+	}
+}
+
+func (r *otlpReporter) ReportCounter(name string, tags map[string]string, value int64) {
+	r.mu.Lock()
+	c, found := r.counters[name]
+
+	if !found {
+		c, _ = r.meter.Int64Counter(name)
+		r.counters[name] = c
+	}
+
+	r.mu.Unlock()
+	c.Add(context.Background(), value, metric.WithAttributes(tagsToAttributes(tags)...))
+}
+
+func (r *otlpReporter) ReportGauge(name string, tags map[string]string, value float64) {
+	r.mu.Lock()
+	g, found := r.gauges[name]
+
+	if !found {
+		g, _ = r.meter.Float64Gauge(name)
+		r.gauges[name] = g
+	}
+
+	r.mu.Unlock()
+	g.Record(context.Background(), value, metric.WithAttributes(tagsToAttributes(tags)...))
+}
+
+func (r *otlpReporter) ReportTimer(name string, tags map[string]string, interval time.Duration) {
+	r.histogram(name, "s").Record(context.Background(), interval.Seconds(), metric.WithAttributes(tagsToAttributes(tags)...))
+}
+
+func (r *otlpReporter) ReportHistogramValueSamples(
+	name string,
+	tags map[string]string,
+	buckets tally.Buckets,
+	bucketLowerBound float64,
+	bucketUpperBound float64,
+	samples int64,
+) {
+	var v = bucketUpperBound
+
+	if v == math.MaxFloat64 {
+		v = bucketLowerBound
+	}
+
+	r.recordSamples(r.histogram(name, ""), tags, v, samples)
+}
+
+func (r *otlpReporter) ReportHistogramDurationSamples(
+	name string,
+	tags map[string]string,
+	buckets tally.Buckets,
+	bucketLowerBound time.Duration,
+	bucketUpperBound time.Duration,
+	samples int64,
+) {
+	var v = bucketUpperBound
+
+	if v == math.MaxInt64 {
+		v = bucketLowerBound
+	}
+
+	r.recordSamples(r.histogram(name, "s"), tags, v.Seconds(), samples)
+}
+
+func (r *otlpReporter) histogram(name string, unit string) metric.Float64Histogram {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, found := r.histograms[name]
+
+	if !found {
+		h, _ = r.meter.Float64Histogram(name, metric.WithUnit(unit))
+		r.histograms[name] = h
+	}
+
+	return h
+}
+
+func (r *otlpReporter) recordSamples(h metric.Float64Histogram, tags map[string]string, v float64, samples int64) {
+	var opt = metric.WithAttributes(tagsToAttributes(tags)...)
+
+	for i := int64(0); i < samples; i++ {
+		h.Record(context.Background(), v, opt)
+	}
+}
+
+func (r *otlpReporter) Capabilities() tally.Capabilities {
+	return r
+}
+
+func (r *otlpReporter) Reporting() bool {
+	return true
+}
+
+func (r *otlpReporter) Tagging() bool {
+	return true
+}
+
+func (r *otlpReporter) Flush() {}
+
+func tagsToAttributes(tags map[string]string) []attribute.KeyValue {
+	var attrs = make([]attribute.KeyValue, 0, len(tags))
+
+	for k, v := range tags {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+
+	return attrs
+}
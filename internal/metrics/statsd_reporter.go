@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cactus/go-statsd-client/v5/statsd"
+	"github.com/uber-go/tally/v4"
+	tallystatsd "github.com/uber-go/tally/v4/statsd"
+)
+
+type StatsDConfig struct {
+	Addr          string
+	Prefix        string
+	FlushInterval time.Duration
+	FlushBytes    int
+}
+
+func (conf StatsDConfig) WithDefaults() StatsDConfig {
+	if len(conf.Addr) == 0 {
+		conf.Addr = "127.0.0.1:8125"
+	}
+
+	if conf.FlushInterval == 0 {
+		conf.FlushInterval = 100 * time.Millisecond
+	}
+
+	return conf
+}
+
+func newStatsDReporter(conf StatsDConfig) (tally.StatsReporter, statsd.Statter, error) {
+	conf = conf.WithDefaults()
+
+	client, err := statsd.NewClientWithConfig(&statsd.ClientConfig{
+		Address:       conf.Addr,
+		Prefix:        conf.Prefix,
+		UseBuffered:   true,
+		FlushInterval: conf.FlushInterval,
+		FlushBytes:    conf.FlushBytes,
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &tagFoldingReporter{StatsReporter: tallystatsd.NewReporter(client, tallystatsd.Options{})}, client, nil
+}
+
+// tagFoldingReporter folds tags into the metric name as sorted .key.value segments
+// for backends that do not support tagging, so that tagged series stay distinct.
+type tagFoldingReporter struct {
+	tally.StatsReporter
+}
+
+func (r *tagFoldingReporter) ReportCounter(name string, tags map[string]string, value int64) {
+	r.StatsReporter.ReportCounter(foldTags(name, tags), nil, value)
+}
+
+func (r *tagFoldingReporter) ReportGauge(name string, tags map[string]string, value float64) {
+	r.StatsReporter.ReportGauge(foldTags(name, tags), nil, value)
+}
+
+func (r *tagFoldingReporter) ReportTimer(name string, tags map[string]string, interval time.Duration) {
+	r.StatsReporter.ReportTimer(foldTags(name, tags), nil, interval)
+}
+
+func (r *tagFoldingReporter) ReportHistogramValueSamples(
+	name string,
+	tags map[string]string,
+	buckets tally.Buckets,
+	bucketLowerBound float64,
+	bucketUpperBound float64,
+	samples int64,
+) {
+	r.StatsReporter.ReportHistogramValueSamples(foldTags(name, tags), nil, buckets, bucketLowerBound, bucketUpperBound, samples)
+}
+
+func (r *tagFoldingReporter) ReportHistogramDurationSamples(
+	name string,
+	tags map[string]string,
+	buckets tally.Buckets,
+	bucketLowerBound time.Duration,
+	bucketUpperBound time.Duration,
+	samples int64,
+) {
+	r.StatsReporter.ReportHistogramDurationSamples(foldTags(name, tags), nil, buckets, bucketLowerBound, bucketUpperBound, samples)
+}
+
+func foldTags(name string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return name
+	}
+
+	var (
+		keys = make([]string, 0, len(tags))
+		sb   strings.Builder
+	)
+
+	for k := range tags {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+	sb.WriteString(name)
+
+	for _, k := range keys {
+		sb.WriteString(".")
+		sb.WriteString(k)
+		sb.WriteString(".")
+		sb.WriteString(tags[k])
+	}
+
+	return sb.String()
+}
+
+func (r *tagFoldingReporter) Capabilities() tally.Capabilities {
+	return r
+}
+
+func (r *tagFoldingReporter) Reporting() bool {
+	return true
+}
+
+func (r *tagFoldingReporter) Tagging() bool {
+	return true
+}
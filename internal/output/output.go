@@ -0,0 +1,183 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+type Format string
+
+const (
+	Table Format = "table"
+	JSON  Format = "json"
+	JSONL Format = "jsonl"
+	CSV   Format = "csv"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case Table, JSON, JSONL, CSV:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown output format %s: must be table, json, jsonl or csv", s)
+	}
+}
+
+// Write writes rows in the given format, with columns in the given order (see Columns).
+func Write(w io.Writer, format Format, rows []map[string]any, order []string) error {
+	switch format {
+	case Table:
+		return WriteTable(w, rows, order)
+	case JSON:
+		return WriteJSON(w, rows, order)
+	case JSONL:
+		return WriteJSONL(w, rows, order)
+	case CSV:
+		return WriteCSV(w, rows, order)
+	default:
+		return fmt.Errorf("unknown output format %s", format)
+	}
+}
+
+// WriteJSON writes rows as an indented JSON array.
+func WriteJSON(w io.Writer, rows []map[string]any, order []string) error {
+	var (
+		cols = Columns(rows, order)
+		buf  bytes.Buffer
+	)
+
+	buf.WriteString("[")
+
+	for i, row := range rows {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		if err := writeObject(&buf, row, cols); err != nil {
+			return err
+		}
+	}
+
+	buf.WriteString("]")
+
+	var out bytes.Buffer
+
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return err
+	}
+
+	out.WriteString("\n")
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// WriteJSONL writes rows as JSON objects, one per line.
+func WriteJSONL(w io.Writer, rows []map[string]any, order []string) error {
+	var (
+		cols = Columns(rows, order)
+		buf  bytes.Buffer
+	)
+
+	for _, row := range rows {
+		buf.Reset()
+
+		if err := writeObject(&buf, row, cols); err != nil {
+			return err
+		}
+
+		buf.WriteString("\n")
+
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeObject writes row as a JSON object with its keys in the order of cols,
+// which encoding/json would sort.
+func writeObject(buf *bytes.Buffer, row map[string]any, cols []string) error {
+	buf.WriteString("{")
+
+	for _, col := range cols {
+		v, found := row[col]
+
+		if !found {
+			continue
+		}
+
+		if buf.Bytes()[buf.Len()-1] != '{' {
+			buf.WriteString(",")
+		}
+
+		k, err := json.Marshal(col)
+
+		if err != nil {
+			return err
+		}
+
+		js, err := json.Marshal(v)
+
+		if err != nil {
+			return fmt.Errorf("failed to encode column %s: %w", col, err)
+		}
+
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(js)
+	}
+
+	buf.WriteString("}")
+	return nil
+}
+
+// WriteCSV writes rows as CSV with a header line, NULL values being empty fields.
+func WriteCSV(w io.Writer, rows []map[string]any, order []string) error {
+	var (
+		cols = Columns(rows, order)
+		cw   = csv.NewWriter(w)
+	)
+
+	if len(cols) > 0 {
+		if err := cw.Write(cols); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range rows {
+		var record = make([]string, len(cols))
+
+		for i, col := range cols {
+			if !isNull(row[col]) {
+				record[i] = FormatValue(row[col])
+			}
+		}
+
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func isNull(v any) bool {
+	var rv = reflect.ValueOf(v)
+
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return true
+		}
+
+		rv = rv.Elem()
+	}
+
+	return !rv.IsValid()
+}
@@ -0,0 +1,54 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	var (
+		rows  = []map[string]any{{"b": ptr(int64(1)), "a": ptr("x,y")}, {"b": ptr(int64(2)), "a": (*string)(nil)}}
+		order = []string{"b", "a"}
+	)
+
+	var tests = []struct {
+		format Format
+		want   string
+	}{
+		{Table, "b  a\n-  -\n1  x,y\n2  NULL\n(2 row(s))\n"},
+		{JSON, "[\n  {\n    \"b\": 1,\n    \"a\": \"x,y\"\n  },\n  {\n    \"b\": 2,\n    \"a\": null\n  }\n]\n"},
+		{JSONL, "{\"b\":1,\"a\":\"x,y\"}\n{\"b\":2,\"a\":null}\n"},
+		{CSV, "b,a\n1,\"x,y\"\n2,\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+
+		if err := Write(&buf, test.format, rows, order); err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+
+		if buf.String() != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.format, buf.String(), test.want)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := WriteJSON(&buf, nil, nil); err != nil || buf.String() != "[]\n" {
+		t.Errorf("WriteJSON of no rows = %q, %v", buf.String(), err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"table", "JSON", "jsonl", "Csv"} {
+		if _, err := ParseFormat(s); err != nil {
+			t.Errorf("ParseFormat(%q): %v", s, err)
+		}
+	}
+
+	if _, err := ParseFormat("parquet"); err == nil {
+		t.Errorf("ParseFormat(parquet) should fail")
+	}
+}
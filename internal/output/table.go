@@ -0,0 +1,139 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/dustin/go-humanize"
+)
+
+// Columns returns the column names of rows in the given order, usually the engine's one
+// (see engine.QueryMetadata.Columns). Since rows do not keep the order of the query,
+// columns missing from order are appended sorted.
+func Columns(rows []map[string]any, order []string) []string {
+	var (
+		cols = make(map[string]struct{})
+		res  []string
+	)
+
+	for _, row := range rows {
+		for k := range row {
+			cols[k] = struct{}{}
+		}
+	}
+
+	for _, col := range order {
+		if _, found := cols[col]; found {
+			res = append(res, col)
+			delete(cols, col)
+		}
+	}
+
+	return append(res, slices.Sorted(maps.Keys(cols))...)
+}
+
+// WriteTable writes rows as an aligned text table followed by the row count.
+func WriteTable(w io.Writer, rows []map[string]any, order []string) error {
+	var (
+		cols = Columns(rows, order)
+		tw   = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		sep  = make([]string, len(cols))
+	)
+
+	if len(cols) > 0 {
+		for i, col := range cols {
+			sep[i] = strings.Repeat("-", len(col))
+		}
+
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+		fmt.Fprintln(tw, strings.Join(sep, "\t"))
+
+		for _, row := range rows {
+			var values = make([]string, len(cols))
+
+			for i, col := range cols {
+				values[i] = strings.ReplaceAll(FormatValue(row[col]), "\n", `\n`)
+			}
+
+			fmt.Fprintln(tw, strings.Join(values, "\t"))
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "(%d row(s))\n", len(rows))
+	return err
+}
+
+// WriteMetadata writes a one line summary of the cost of a query.
+func WriteMetadata(w io.Writer, md *engine.QueryMetadata) error {
+	if md == nil {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(
+		w,
+		"Elapsed: %s. Read %d rows, %s. Wrote %d rows, %s. Peak memory: %s.\n",
+		md.Elapsed,
+		md.Rows,
+		humanize.Bytes(md.Bytes),
+		md.WroteRows,
+		humanize.Bytes(md.WroteBytes),
+		humanize.Bytes(md.MemoryPeakUsage),
+	)
+
+	return err
+}
+
+// FormatValue formats a value scanned by an engine, which is usually a pointer (or a pointer
+// to a pointer for Nullable columns) to the column type.
+func FormatValue(v any) string {
+	var rv = reflect.ValueOf(v)
+
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "NULL"
+		}
+
+		// types such as big.Int only implement fmt.Stringer on their pointer
+		if _, ok := rv.Elem().Interface().(fmt.Stringer); !ok {
+			if s, ok := rv.Interface().(fmt.Stringer); ok {
+				return s.String()
+			}
+		}
+
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() {
+		return "NULL"
+	}
+
+	switch v := rv.Interface().(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		if js, err := json.Marshal(rv.Interface()); err == nil {
+			return string(js)
+		}
+	}
+
+	return fmt.Sprint(rv.Interface())
+}
@@ -0,0 +1,70 @@
+package output
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestFormatValue(t *testing.T) {
+	var tests = []struct {
+		v    any
+		want string
+	}{
+		{nil, "NULL"},
+		{"abc", "abc"},
+		{ptr("abc"), "abc"},
+		{ptr(ptr("nullable")), "nullable"},
+		{ptr((*string)(nil)), "NULL"},
+		{(*int32)(nil), "NULL"},
+		{ptr(uint64(18446744073709551615)), "18446744073709551615"},
+		{ptr(int8(-3)), "-3"},
+		{ptr(1.5), "1.5"},
+		{ptr(true), "true"},
+		{ptr(time.Date(2024, 5, 6, 7, 8, 9, 120000000, time.UTC)), "2024-05-06T07:08:09.12Z"},
+		{ptr(uuid.MustParse("0190d1a4-7b6c-7f00-8000-000000000001")), "0190d1a4-7b6c-7f00-8000-000000000001"},
+		{ptr(decimal.RequireFromString("123.450")), "123.45"},
+		{ptr(*big.NewInt(42)), "42"},
+		{ptr([]string{"a", "b"}), `["a","b"]`},
+		{ptr(map[string]uint32{"x": 1}), `{"x":1}`},
+		{ptr([]*string{ptr("a"), nil}), `["a",null]`},
+	}
+
+	for _, test := range tests {
+		if got := FormatValue(test.v); got != test.want {
+			t.Errorf("FormatValue(%#v) = %q, want %q", test.v, got, test.want)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	var rows = []map[string]any{{"b": 1, "a": 2}, {"c": 3, "a": 4}}
+
+	var tests = []struct {
+		order []string
+		want  []string
+	}{
+		{nil, []string{"a", "b", "c"}},
+		{[]string{"c", "b", "a"}, []string{"c", "b", "a"}},
+		// columns hidden from rows are dropped, columns missing from order are appended sorted
+		{[]string{"_hidden", "b"}, []string{"b", "a", "c"}},
+	}
+
+	for _, test := range tests {
+		if got := Columns(rows, test.order); !slices.Equal(got, test.want) {
+			t.Errorf("Columns(%v) = %v, want %v", test.order, got, test.want)
+		}
+	}
+
+	if got := Columns(nil, []string{"a"}); len(got) > 0 {
+		t.Errorf("Columns of no rows = %v, want none", got)
+	}
+}
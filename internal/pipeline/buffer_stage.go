@@ -4,10 +4,8 @@ import (
 	"context"
 	"fmt"
 	"math"
-	"text/template"
 	"time"
 
-	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/agnosticeng/agt/internal/ch"
 	"github.com/agnosticeng/agt/internal/engine"
 	"github.com/agnosticeng/agt/internal/utils"
@@ -23,6 +21,7 @@ type BufferStageConfig struct {
 	Queries            []ch.QueryRef
 	MaxDuration        time.Duration
 	MaxRows            int
+	Session            engine.SessionMode
 	ClickhouseSettings map[string]any
 }
 
@@ -33,7 +32,7 @@ func (conf BufferStageConfig) WithDefaults() BufferStageConfig {
 func BufferStage(
 	ctx context.Context,
 	engine engine.Engine,
-	tmpl *template.Template,
+	templates *utils.TemplateStore,
 	commonVars map[string]any,
 	inchan <-chan Vars,
 	outchan chan<- Vars,
@@ -53,6 +52,7 @@ func BufferStage(
 
 	var (
 		logger           = slogctx.FromCtx(ctx)
+		state            = stageStateFromContext(ctx)
 		metricsScope     = tallyctx.FromContextOrNoop(ctx)
 		procMetrics      = NewStageMetrics(metricsScope)
 		enterMetrics     = conf.Enter.Metrics(metricsScope)
@@ -65,7 +65,7 @@ func BufferStage(
 	defer logger.Debug("stopped")
 
 	if len(conf.ClickhouseSettings) > 0 {
-		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(ch.NormalizeSettings(conf.ClickhouseSettings)))
+		ctx = ch.WithSettings(ctx, conf.ClickhouseSettings)
 	}
 
 	var (
@@ -73,6 +73,12 @@ func BufferStage(
 		isInChanClosed bool
 	)
 
+	defer func() {
+		if currentBatch != nil {
+			currentBatch.closeSession()
+		}
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -86,36 +92,51 @@ func BufferStage(
 				break
 			}
 
+			var tmpl = templates.Load()
+
 			if currentBatch == nil {
+				var err error
+
 				currentBatch = newBatch(conf.MaxDuration)
+				currentBatch.task = TaskFromVars(vars)
+				currentBatch.engine, currentBatch.closeSession, err = WithSession(currentBatch.task.Context(ctx), engine, conf.Session)
+
+				if err != nil {
+					currentBatch = nil
+					return err
+				}
 
 				if conf.Enter != nil {
-					if _, _, err := RunQuery(
-						ctx,
-						engine,
+					_, md, err := RunQuery(
+						currentBatch.task.Context(ctx),
+						currentBatch.engine,
 						tmpl,
 						*conf.Enter,
-						utils.MergeMaps(commonVars, vars),
+						bufferEnterVars(commonVars, vars),
 						procMetrics,
 						enterMetrics,
-					); err != nil {
+					)
+
+					if err != nil {
 						return err
 					}
+
+					currentBatch.task = currentBatch.task.AddCost(md)
 				}
+			} else {
+				var other = TaskFromVars(vars)
+				currentBatch.task = currentBatch.task.Merge(other)
+				state.leave(other.ID)
 			}
 
+			currentBatch.tasks++
+
 			rows, md, err := RunQueries(
-				ctx,
-				engine,
+				currentBatch.task.Context(ctx),
+				currentBatch.engine,
 				tmpl,
 				conf.Queries,
-				utils.MergeMaps(
-					map[string]any{
-						"LEFT":  currentBatch.vars,
-						"RIGHT": vars,
-					},
-					commonVars,
-				),
+				bufferQueriesVars(commonVars, currentBatch.vars, vars),
 				procMetrics,
 				queriesMetrics,
 			)
@@ -127,14 +148,16 @@ func BufferStage(
 
 			currentBatch.rows += int(md.WroteRows)
 			currentBatch.vars = utils.LastElemOrDefault(rows, currentBatch.vars)
+			currentBatch.task = currentBatch.task.AddCost(md)
+			state.setBuffer(currentBatch.status())
 
 			if conf.Condition != nil {
-				rows, _, err := RunQuery(
-					ctx,
-					engine,
+				rows, md, err := RunQuery(
+					currentBatch.task.Context(ctx),
+					currentBatch.engine,
 					tmpl,
 					*conf.Condition,
-					utils.MergeMaps(commonVars, currentBatch.vars),
+					bufferBatchVars(commonVars, currentBatch.vars),
 					procMetrics,
 					conditionMetrics,
 				)
@@ -144,17 +167,19 @@ func BufferStage(
 					return err
 				}
 
+				currentBatch.task = currentBatch.task.AddCost(md)
+
 				if len(rows) != 1 {
 					return fmt.Errorf("condition query must return exactly 1 row: %d returned", len(rows))
 				}
 
-				v, found := rows[0]["value"].(*uint8)
+				v, err := ch.ToInt64(rows[0]["value"])
 
-				if !found || v == nil {
-					return fmt.Errorf("condition query must return a single `value` column of type UInt8: returned %v", rows[0])
+				if err != nil {
+					return fmt.Errorf("condition query must return a single integer `value` column: returned %v: %w", rows[0], err)
 				}
 
-				if *v > 0 {
+				if v > 0 {
 					continue
 				}
 			}
@@ -166,26 +191,32 @@ func BufferStage(
 
 		if currentBatch != nil {
 			if conf.Leave != nil {
-				if _, _, err := RunQuery(
-					ctx,
-					engine,
-					tmpl,
+				_, md, err := RunQuery(
+					currentBatch.task.Context(ctx),
+					currentBatch.engine,
+					templates.Load(),
 					*conf.Leave,
-					utils.MergeMaps(commonVars, currentBatch.vars),
+					bufferBatchVars(commonVars, currentBatch.vars),
 					procMetrics,
 					leaveMetrics,
-				); err != nil {
+				)
+
+				if err != nil {
 					return err
 				}
+
+				currentBatch.task = currentBatch.task.AddCost(md)
 			}
 
 			select {
 			case <-ctx.Done():
 				return nil
-			case outchan <- currentBatch.vars:
+			case outchan <- WithTask(currentBatch.vars, currentBatch.task):
 			}
 
+			currentBatch.closeSession()
 			currentBatch = nil
+			state.setBuffer(nil)
 		}
 
 		if isInChanClosed {
@@ -195,13 +226,18 @@ func BufferStage(
 }
 
 type batch struct {
-	vars  Vars
-	timer *time.Timer
-	rows  int
+	vars         Vars
+	task         Task
+	engine       engine.Engine
+	closeSession func() error
+	timer        *time.Timer
+	rows         int
+	tasks        int
+	openedAt     time.Time
 }
 
 func newBatch(maxWait time.Duration) *batch {
-	var b batch
+	var b = batch{openedAt: time.Now()}
 
 	if maxWait > 0 {
 		b.timer = time.NewTimer(maxWait)
@@ -217,3 +253,7 @@ func (b *batch) C() <-chan time.Time {
 
 	return b.timer.C
 }
+
+func (b *batch) status() *BufferStatus {
+	return &BufferStatus{Rows: b.rows, Tasks: b.tasks, OpenedAt: b.openedAt}
+}
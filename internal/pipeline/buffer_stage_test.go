@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
+)
+
+const bufferTemplates = `
+	{{define "enter"}}ENTER {{.N}} {{.C}}{{end}}
+	{{define "insert"}}SELECT {{.RIGHT.N}} AS K, {{with .LEFT}}{{.K}}{{else}}0{{end}} AS PREV, '{{.C}}'{{end}}
+	{{define "condition"}}SELECT {{.K}} < 2 AS value{{end}}
+	{{define "leave"}}LEAVE {{.K}} {{.C}}{{end}}
+`
+
+func TestBufferStage(t *testing.T) {
+	var (
+		enter     = ch.QueryRef{Name: "enter"}
+		condition = ch.QueryRef{Name: "condition"}
+		leave     = ch.QueryRef{Name: "leave"}
+	)
+
+	var tests = []struct {
+		name    string
+		conf    BufferStageConfig
+		queries []string
+		outputs []Vars
+	}{
+		{
+			name: "max rows",
+			conf: BufferStageConfig{Enter: &enter, Leave: &leave, MaxRows: 2},
+			queries: []string{
+				"enter: ENTER 1 c",
+				"insert: SELECT 1 AS K, 0 AS PREV, 'c'",
+				"insert: SELECT 2 AS K, 1 AS PREV, 'c'",
+				"leave: LEAVE 2 c",
+				"enter: ENTER 3 c",
+				"insert: SELECT 3 AS K, 0 AS PREV, 'c'",
+				"leave: LEAVE 3 c",
+			},
+			outputs: []Vars{{"K": 2}, {"K": 3}},
+		},
+		{
+			// a condition returning a non-zero value keeps the batch open whatever its size
+			name: "condition",
+			conf: BufferStageConfig{Condition: &condition, Leave: &leave, MaxRows: 1},
+			queries: []string{
+				"insert: SELECT 1 AS K, 0 AS PREV, 'c'",
+				"condition: SELECT 1 < 2 AS value",
+				"insert: SELECT 2 AS K, 1 AS PREV, 'c'",
+				"condition: SELECT 2 < 2 AS value",
+				"leave: LEAVE 2 c",
+				"insert: SELECT 3 AS K, 0 AS PREV, 'c'",
+				"condition: SELECT 3 < 2 AS value",
+				"leave: LEAVE 3 c",
+			},
+			outputs: []Vars{{"K": 2}, {"K": 3}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				eng = newFakeEngine(t,
+					insertResponse(1),
+					insertResponse(2),
+					insertResponse(3),
+					fake.ResponseConfig{Template: "condition", Pattern: `^SELECT 1 <`, Rows: []map[string]any{{"value": uint8Ptr(1)}}},
+					fake.ResponseConfig{Template: "condition", Rows: []map[string]any{{"value": uint8Ptr(0)}}},
+				)
+				templates = newTemplates(t, bufferTemplates)
+				conf      = test.conf
+			)
+
+			conf.Queries = []ch.QueryRef{{Name: "insert"}}
+
+			var outputs = runStage(t, func(ctx context.Context, inchan <-chan Vars, outchan chan<- Vars) error {
+				return BufferStage(ctx, eng, templates, Vars{"C": "c"}, inchan, outchan, conf)
+			}, Vars{"N": 1}, Vars{"N": 2}, Vars{"N": 3})
+
+			var queries []string
+
+			for _, call := range eng.Calls() {
+				queries = append(queries, call.Template+": "+call.Query)
+			}
+
+			if !reflect.DeepEqual(queries, test.queries) {
+				t.Errorf("got queries\n%q\nwant\n%q", queries, test.queries)
+			}
+
+			if !reflect.DeepEqual(outputs, test.outputs) {
+				t.Errorf("got outputs %v, want %v", outputs, test.outputs)
+			}
+		})
+	}
+}
+
+func TestBufferStageConfig(t *testing.T) {
+	var tests = []struct {
+		name string
+		conf BufferStageConfig
+	}{
+		{"no queries", BufferStageConfig{MaxRows: 1}},
+		{"no end", BufferStageConfig{Queries: []ch.QueryRef{{Name: "insert"}}}},
+	}
+
+	for _, test := range tests {
+		var eng = newFakeEngine(t)
+
+		if err := BufferStage(context.Background(), eng, newTemplates(t, bufferTemplates), nil, nil, nil, test.conf); err == nil {
+			t.Errorf("%s: BufferStage should fail", test.name)
+		}
+
+		if calls := eng.Calls(); len(calls) > 0 {
+			t.Errorf("%s: got %d calls, want 0", test.name, len(calls))
+		}
+	}
+}
+
+// insertResponse answers the buffer query of the task n with the row K = n, accounting for 1 written row.
+func insertResponse(n int) fake.ResponseConfig {
+	return fake.ResponseConfig{
+		Template: "insert",
+		Pattern:  `^SELECT ` + string(rune('0'+n)) + ` AS K`,
+		Rows:     []map[string]any{{"K": n}},
+		Metadata: engine.QueryMetadata{WroteRows: 1},
+	}
+}
+
+func uint8Ptr(v uint8) *uint8 {
+	return &v
+}
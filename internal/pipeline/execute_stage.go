@@ -2,9 +2,7 @@ package pipeline
 
 import (
 	"context"
-	"text/template"
 
-	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/agnosticeng/agt/internal/ch"
 	"github.com/agnosticeng/agt/internal/engine"
 	"github.com/agnosticeng/agt/internal/utils"
@@ -17,6 +15,7 @@ import (
 type ExecuteStageConfig struct {
 	mapstream.MapStreamConfig
 	Queries            []ch.QueryRef
+	Session            engine.SessionMode
 	ClickhouseSettings map[string]any
 }
 
@@ -27,7 +26,7 @@ func (conf ExecuteStageConfig) WithDefaults() ExecuteStageConfig {
 func ExecuteStage(
 	ctx context.Context,
 	engine engine.Engine,
-	tmpl *template.Template,
+	templates *utils.TemplateStore,
 	commonVars map[string]any,
 	inchan <-chan Vars,
 	outchan chan<- Vars,
@@ -44,7 +43,7 @@ func ExecuteStage(
 	defer logger.Debug("stopped")
 
 	if len(conf.ClickhouseSettings) > 0 {
-		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(ch.NormalizeSettings(conf.ClickhouseSettings)))
+		ctx = ch.WithSettings(ctx, conf.ClickhouseSettings)
 	}
 
 	return mapstream.MapStreamIndex(
@@ -53,14 +52,18 @@ func ExecuteStage(
 		outchan,
 		func(ctx context.Context, i int) func(context.Context, Vars) (Vars, error) {
 			return func(ctx context.Context, vars Vars) (Vars, error) {
+				var task = TaskFromVars(vars)
+
 				ctx = slogctx.With(ctx, "worker", i)
+				ctx = task.Context(ctx)
 
-				rows, _, err := RunQueries(
+				rows, md, err := RunQueriesInSession(
 					ctx,
 					engine,
-					tmpl,
+					conf.Session,
+					templates.Load(),
 					conf.Queries,
-					utils.MergeMaps(commonVars, vars),
+					executeVars(commonVars, vars),
 					procMetrics,
 					queriesMetrics,
 				)
@@ -69,7 +72,10 @@ func ExecuteStage(
 					return nil, err
 				}
 
-				return utils.LastElemOrDefault(rows, vars), nil
+				return WithTask(
+					utils.LastElemOrDefault(rows, vars),
+					task.AddCost(md),
+				), nil
 			}
 		},
 		conf.MapStreamConfig,
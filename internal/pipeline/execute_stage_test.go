@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
+	"github.com/agnosticeng/concu/mapstream"
+)
+
+func TestExecuteStage(t *testing.T) {
+	var (
+		eng = newFakeEngine(t,
+			fake.ResponseConfig{Template: "b", Pattern: `^SELECT 1 `, Rows: []map[string]any{{"M": 10}}},
+		)
+		templates = newTemplates(t, `
+			{{define "a"}}INSERT {{.N}} INTO {{.TABLE}}{{end}}
+			{{define "b"}}SELECT {{.N}} + 9 AS M{{end}}
+		`)
+		conf = ExecuteStageConfig{
+			MapStreamConfig: mapstream.MapStreamConfig{PoolSize: 1, Ordered: true},
+			Queries:         []ch.QueryRef{{Name: "a"}, {Name: "b"}},
+		}
+	)
+
+	var outputs = runStage(t, func(ctx context.Context, inchan <-chan Vars, outchan chan<- Vars) error {
+		return ExecuteStage(ctx, eng, templates, Vars{"TABLE": "t"}, inchan, outchan, conf)
+	}, Vars{"N": 1}, Vars{"N": 2})
+
+	var queries []string
+
+	for _, call := range eng.Calls() {
+		queries = append(queries, call.Template+": "+call.Query)
+	}
+
+	if want := []string{"a: INSERT 1 INTO t", "b: SELECT 1 + 9 AS M", "a: INSERT 2 INTO t", "b: SELECT 2 + 9 AS M"}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("got queries %q, want %q", queries, want)
+	}
+
+	// the output of a task is the last row returned, or its input when no query returned rows
+	if want := []Vars{{"M": 10}, {"N": 2}}; !reflect.DeepEqual(outputs, want) {
+		t.Errorf("got outputs %v, want %v", outputs, want)
+	}
+}
+
+func TestExecuteStageSession(t *testing.T) {
+	var (
+		eng       = newFakeEngine(t)
+		templates = newTemplates(t, `{{define "a"}}SELECT 1{{end}}{{define "b"}}SELECT 2{{end}}`)
+		conf      = ExecuteStageConfig{
+			MapStreamConfig: mapstream.MapStreamConfig{PoolSize: 1},
+			Queries:         []ch.QueryRef{{Name: "a"}, {Name: "b"}},
+			Session:         "CONNECTION",
+		}
+	)
+
+	runStage(t, func(ctx context.Context, inchan <-chan Vars, outchan chan<- Vars) error {
+		return ExecuteStage(ctx, eng, templates, nil, inchan, outchan, conf)
+	}, Vars{}, Vars{})
+
+	var calls = eng.Calls()
+
+	if len(calls) != 4 {
+		t.Fatalf("got %d calls, want 4", len(calls))
+	}
+
+	// the queries of a task share a session, each task opening its own
+	if len(calls[0].Session) == 0 || calls[0].Session != calls[1].Session || calls[2].Session != calls[3].Session || calls[1].Session == calls[2].Session {
+		t.Errorf("unexpected sessions: %s, %s, %s, %s", calls[0].Session, calls[1].Session, calls[2].Session, calls[3].Session)
+	}
+}
@@ -2,22 +2,61 @@ package pipeline
 
 import (
 	"context"
+	"time"
 
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/agnosticeng/tallyctx"
+	"github.com/samber/lo"
+	"github.com/uber-go/tally/v4"
 	slogctx "github.com/veqryn/slog-context"
+	"go.opentelemetry.io/otel/codes"
 )
 
-type FinalizerConfig struct{}
+type FinalizerConfig struct {
+	Engine             string
+	Queries            []ch.QueryRef
+	Session            engine.SessionMode
+	ClickhouseSettings map[string]any
+}
+
+type finalizedHandlerKey struct{}
+
+// WithFinalizedHandler registers f to be called with the vars of every task the finalizer is done with.
+func WithFinalizedHandler(ctx context.Context, f func(Vars)) context.Context {
+	return context.WithValue(ctx, finalizedHandlerKey{}, f)
+}
+
+func finalizedHandlerFromContext(ctx context.Context) func(Vars) {
+	f, _ := ctx.Value(finalizedHandlerKey{}).(func(Vars))
+	return f
+}
 
 func Finalizer(
 	ctx context.Context,
+	engine engine.Engine,
+	templates *utils.TemplateStore,
+	commonVars map[string]any,
 	inchan <-chan Vars,
 	conf FinalizerConfig,
 ) error {
-	var logger = slogctx.FromCtx(ctx)
+	var (
+		logger         = slogctx.FromCtx(ctx)
+		metricsScope   = tallyctx.FromContextOrNoop(ctx)
+		procMetrics    = NewStageMetrics(metricsScope)
+		queriesMetrics = lo.Map(conf.Queries, func(query ch.QueryRef, i int) *ch.QueryMetrics { return query.Metrics(metricsScope) })
+		taskAge        = metricsScope.Histogram("task_age", tally.MustMakeExponentialDurationBuckets(time.Second, 2, 14))
+		onFinalized    = finalizedHandlerFromContext(ctx)
+	)
 
 	logger.Debug("started")
 	defer logger.Debug("stopped")
 
+	if len(conf.ClickhouseSettings) > 0 {
+		ctx = ch.WithSettings(ctx, conf.ClickhouseSettings)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -27,7 +66,53 @@ func Finalizer(
 				return nil
 			}
 
-			logger.Info("task finalized", varsToKeyValues(vars)...)
+			var task = TaskFromVars(vars)
+
+			if !task.EmittedAt.IsZero() {
+				taskAge.RecordDuration(time.Since(task.EmittedAt))
+			}
+
+			logger.Info("task finalized", append(varsToKeyValues(vars), costToKeyValues(task.Cost)...)...)
+
+			if len(conf.Queries) > 0 {
+				if _, _, err := RunQueriesInSession(
+					task.Context(ctx),
+					engine,
+					conf.Session,
+					templates.Load(),
+					conf.Queries,
+					finalizerVars(commonVars, vars),
+					procMetrics,
+					queriesMetrics,
+				); err != nil {
+					endTaskSpans(task, err)
+					return err
+				}
+			}
+
+			endTaskSpans(task, nil)
+
+			if onFinalized != nil {
+				onFinalized(vars)
+			}
 		}
 	}
 }
+
+func endTaskSpans(task Task, err error) {
+	if task.StageSpan != nil {
+		task.StageSpan.End()
+	}
+
+	if task.Span == nil {
+		return
+	}
+
+	if err != nil {
+		task.Span.RecordError(err)
+		task.Span.SetStatus(codes.Error, err.Error())
+	}
+
+	task.Span.SetAttributes(costToAttributes(task.Cost)...)
+	task.Span.End()
+}
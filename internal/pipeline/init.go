@@ -2,9 +2,7 @@ package pipeline
 
 import (
 	"context"
-	"text/template"
 
-	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/agnosticeng/agt/internal/ch"
 	"github.com/agnosticeng/agt/internal/engine"
 	"github.com/agnosticeng/agt/internal/utils"
@@ -12,7 +10,9 @@ import (
 )
 
 type InitConfig struct {
+	Engine             string
 	Queries            []ch.QueryRef
+	Session            engine.SessionMode
 	ClickhouseSettings map[string]any
 }
 
@@ -23,17 +23,17 @@ func (conf InitConfig) WithDefaults() InitConfig {
 func Init(
 	ctx context.Context,
 	engine engine.Engine,
-	tmpl *template.Template,
+	templates *utils.TemplateStore,
 	vars map[string]interface{},
 	conf InitConfig,
 ) (map[string]any, error) {
 	var logger = slogctx.FromCtx(ctx)
 
 	if len(conf.ClickhouseSettings) > 0 {
-		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(ch.NormalizeSettings(conf.ClickhouseSettings)))
+		ctx = ch.WithSettings(ctx, conf.ClickhouseSettings)
 	}
 
-	rows, _, err := RunQueries(ctx, engine, tmpl, conf.Queries, vars, nil, nil)
+	rows, _, err := RunQueriesInSession(ctx, engine, conf.Session, templates.Load(), conf.Queries, vars, nil, nil)
 
 	if err != nil {
 		return nil, err
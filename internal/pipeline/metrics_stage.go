@@ -3,28 +3,40 @@ package pipeline
 import (
 	"context"
 	"fmt"
-	"reflect"
-	"text/template"
+	"time"
 
-	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/agnosticeng/agt/internal/ch"
 	"github.com/agnosticeng/agt/internal/engine"
 	"github.com/agnosticeng/agt/internal/utils"
 	"github.com/agnosticeng/concu/mapstream"
 	"github.com/agnosticeng/tallyctx"
+	"github.com/samber/lo"
 	"github.com/uber-go/tally/v4"
 )
 
 type MetricType string
 
 var (
-	MetricCounter MetricType = "COUNTER"
-	MetricGauge   MetricType = "GAUGE"
+	MetricCounter   MetricType = "COUNTER"
+	MetricGauge     MetricType = "GAUGE"
+	MetricHistogram MetricType = "HISTOGRAM"
+	MetricTimer     MetricType = "TIMER"
 )
 
 type MetricConfig struct {
-	Name string
-	Type MetricType
+	Name    string
+	Type    MetricType
+	Column  string
+	Tags    []string
+	Buckets []float64
+}
+
+func (conf MetricConfig) WithDefaults() MetricConfig {
+	if len(conf.Column) == 0 {
+		conf.Column = conf.Name
+	}
+
+	return conf
 }
 
 type MetricsStageConfig struct {
@@ -40,7 +52,7 @@ func (conf MetricsStageConfig) WithDefaults() MetricsStageConfig {
 func MetricsStage(
 	ctx context.Context,
 	engine engine.Engine,
-	tmpl *template.Template,
+	templates *utils.TemplateStore,
 	commonVars map[string]any,
 	inchan <-chan Vars,
 	outchan chan<- Vars,
@@ -50,22 +62,26 @@ func MetricsStage(
 		metricsScope = tallyctx.FromContextOrNoop(ctx)
 		procMetrics  = NewStageMetrics(metricsScope)
 		queryMetrics = conf.Query.Metrics(metricsScope)
-		taskMetrics  = make(map[string]any)
+		metricConfs  = lo.Map(conf.Metrics, func(conf MetricConfig, _ int) MetricConfig { return conf.WithDefaults() })
+		buckets      = make([]tally.Buckets, len(metricConfs))
 	)
 
-	for _, conf := range conf.Metrics {
-		switch conf.Type {
-		case MetricCounter:
-			taskMetrics[conf.Name] = metricsScope.Counter(conf.Name)
-		case MetricGauge:
-			taskMetrics[conf.Name] = metricsScope.Gauge(conf.Name)
+	for i, metricConf := range metricConfs {
+		switch metricConf.Type {
+		case MetricCounter, MetricGauge, MetricTimer:
+		case MetricHistogram:
+			if len(metricConf.Buckets) > 0 {
+				buckets[i] = tally.ValueBuckets(metricConf.Buckets)
+			} else {
+				buckets[i] = tally.MustMakeExponentialValueBuckets(1, 2, 20)
+			}
 		default:
-			return fmt.Errorf("unknown metric type: %v", conf.Type)
+			return fmt.Errorf("unknown metric type: %v", metricConf.Type)
 		}
 	}
 
 	if len(conf.ClickhouseSettings) > 0 {
-		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(ch.NormalizeSettings(conf.ClickhouseSettings)))
+		ctx = ch.WithSettings(ctx, conf.ClickhouseSettings)
 	}
 
 	return mapstream.Mapper(
@@ -73,12 +89,14 @@ func MetricsStage(
 		inchan,
 		outchan,
 		func(ctx context.Context, vars Vars) (Vars, error) {
-			rows, _, err := RunQuery(
-				ctx,
+			var task = TaskFromVars(vars)
+
+			rows, md, err := RunQuery(
+				task.Context(ctx),
 				engine,
-				tmpl,
+				templates.Load(),
 				conf.Query,
-				utils.MergeMaps(vars, commonVars),
+				metricsVars(commonVars, vars),
 				procMetrics,
 				queryMetrics,
 			)
@@ -87,53 +105,92 @@ func MetricsStage(
 				return nil, err
 			}
 
-			if len(rows) != 1 {
-				return nil, fmt.Errorf("task metric query must return exactly 1 row: %d returned", len(rows))
-			}
-
-			for k, v := range taskMetrics {
-				switch v := v.(type) {
-				case tally.Counter:
-					if i, err := tryGetFromRow[int64](rows[0], k); err != nil {
-						return nil, err
-					} else {
-						v.Inc(i)
+			for _, row := range rows {
+				for i, metricConf := range metricConfs {
+					if err := recordMetric(metricsScope, metricConf, buckets[i], row); err != nil {
+						return nil, fmt.Errorf("failed to record metric %s: %w", metricConf.Name, err)
 					}
-				case tally.Gauge:
-					if f, err := tryGetFromRow[float64](rows[0], k); err != nil {
-						return nil, err
-					} else {
-						v.Update(f)
-					}
-				default:
-					return nil, fmt.Errorf("unknown metric type: %v", reflect.TypeOf(v))
 				}
 			}
 
-			return vars, nil
+			return WithTask(vars, task.AddCost(md)), nil
 		},
 	)
 }
 
-func tryGetFromRow[T any](row map[string]any, column string) (T, error) {
-	var zero T
+func recordMetric(scope tally.Scope, conf MetricConfig, buckets tally.Buckets, row map[string]any) error {
+	if len(conf.Tags) > 0 {
+		var tags = make(map[string]string, len(conf.Tags))
 
-	v, found := row[column]
+		for _, column := range conf.Tags {
+			v, err := getFromRow(row, column)
 
-	if !found {
-		return zero, fmt.Errorf("returned row has no %s column", column)
+			if err != nil {
+				return err
+			}
+
+			if tags[column], err = ch.ToString(v); err != nil {
+				return fmt.Errorf("tag column %s: %w", column, err)
+			}
+		}
+
+		scope = scope.Tagged(tags)
+	}
+
+	v, err := getFromRow(row, conf.Column)
+
+	if err != nil {
+		return err
 	}
 
-	tv, ok := v.(T)
+	switch conf.Type {
+	case MetricCounter:
+		i, err := ch.ToInt64(v)
 
-	if !ok {
-		return zero, fmt.Errorf(
-			"column value for %s is of the wrong type; expected %s, got %s",
-			column,
-			reflect.TypeOf(zero),
-			reflect.TypeOf(v),
-		)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", conf.Column, err)
+		}
+
+		scope.Counter(conf.Name).Inc(i)
+
+	case MetricGauge:
+		f, err := ch.ToFloat64(v)
+
+		if err != nil {
+			return fmt.Errorf("column %s: %w", conf.Column, err)
+		}
+
+		scope.Gauge(conf.Name).Update(f)
+
+	case MetricHistogram:
+		f, err := ch.ToFloat64(v)
+
+		if err != nil {
+			return fmt.Errorf("column %s: %w", conf.Column, err)
+		}
+
+		scope.Histogram(conf.Name, buckets).RecordValue(f)
+
+	case MetricTimer:
+		// timer columns are expressed in seconds
+		f, err := ch.ToFloat64(v)
+
+		if err != nil {
+			return fmt.Errorf("column %s: %w", conf.Column, err)
+		}
+
+		scope.Timer(conf.Name).Record(time.Duration(f * float64(time.Second)))
+	}
+
+	return nil
+}
+
+func getFromRow(row map[string]any, column string) (any, error) {
+	v, found := row[column]
+
+	if !found {
+		return nil, fmt.Errorf("returned row has no %s column", column)
 	}
 
-	return tv, nil
+	return v, nil
 }
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
+	"github.com/agnosticeng/tallyctx"
+	"github.com/shopspring/decimal"
+	"github.com/uber-go/tally/v4"
+)
+
+func TestMetricsStage(t *testing.T) {
+	var (
+		eng = newFakeEngine(t,
+			fake.ResponseConfig{Template: "metrics", Rows: []map[string]any{
+				{"table": "a", "rows": uint64Ptr(2), "size": decimal.RequireFromString("1.5"), "latency": 0.25},
+				{"table": "b", "rows": uint64Ptr(3), "size": decimal.RequireFromString("6"), "latency": 2.0},
+				{"table": "a", "rows": uint64Ptr(5), "size": decimal.RequireFromString("3"), "latency": 0.5},
+			}},
+		)
+		scope   = tally.NewTestScope("", nil)
+		buckets = []float64{2, 4, 8}
+		conf    = MetricsStageConfig{
+			Query: ch.QueryRef{Name: "metrics"},
+			Metrics: []MetricConfig{
+				{Name: "rows", Type: MetricCounter, Tags: []string{"table"}},
+				{Name: "size", Type: MetricGauge, Tags: []string{"table"}},
+				{Name: "size_histogram", Type: MetricHistogram, Column: "size", Buckets: buckets},
+				{Name: "latency", Type: MetricTimer},
+			},
+		}
+	)
+
+	var outputs = runStage(t, func(ctx context.Context, inchan <-chan Vars, outchan chan<- Vars) error {
+		return MetricsStage(tallyctx.NewContext(ctx, scope), eng, newTemplates(t, `{{define "metrics"}}SELECT {{.N}}{{end}}`), nil, inchan, outchan, conf)
+	}, Vars{"N": 1})
+
+	// the stage outputs its input unchanged
+	if want := []Vars{{"N": 1}}; !reflect.DeepEqual(outputs, want) {
+		t.Errorf("got outputs %v, want %v", outputs, want)
+	}
+
+	var snapshot = scope.Snapshot()
+
+	// each row records every metric, tagged with the values of its tag columns
+	var counters = make(map[string]int64)
+
+	for _, counter := range snapshot.Counters() {
+		// the stage counts its rows too, without tags
+		if table, found := counter.Tags()["table"]; found && counter.Name() == "rows" {
+			counters[table] = counter.Value()
+		}
+	}
+
+	if want := map[string]int64{"a": 7, "b": 3}; !reflect.DeepEqual(counters, want) {
+		t.Errorf("got rows counters %v, want %v", counters, want)
+	}
+
+	var gauges = make(map[string]float64)
+
+	for _, gauge := range snapshot.Gauges() {
+		if gauge.Name() == "size" {
+			gauges[gauge.Tags()["table"]] = gauge.Value()
+		}
+	}
+
+	if want := map[string]float64{"a": 3, "b": 6}; !reflect.DeepEqual(gauges, want) {
+		t.Errorf("got size gauges %v, want %v", gauges, want)
+	}
+
+	var histograms int
+
+	for _, histogram := range snapshot.Histograms() {
+		if histogram.Name() != "size_histogram" {
+			continue
+		}
+
+		histograms++
+
+		if want := map[float64]int64{2: 1, 4: 1, 8: 1}; !reflect.DeepEqual(nonZero(histogram.Values()), want) {
+			t.Errorf("got histogram buckets %v, want %v", histogram.Values(), want)
+		}
+	}
+
+	if histograms != 1 {
+		t.Errorf("got %d size histograms, want 1", histograms)
+	}
+
+	var latencies []time.Duration
+
+	for _, timer := range snapshot.Timers() {
+		if timer.Name() == "latency" {
+			latencies = append(latencies, timer.Values()...)
+		}
+	}
+
+	// timer columns are expressed in seconds
+	if want := []time.Duration{250 * time.Millisecond, 2 * time.Second, 500 * time.Millisecond}; !reflect.DeepEqual(latencies, want) {
+		t.Errorf("got latencies %v, want %v", latencies, want)
+	}
+}
+
+func TestMetricsStageErrors(t *testing.T) {
+	var tests = []struct {
+		name   string
+		metric MetricConfig
+	}{
+		{"unknown type", MetricConfig{Name: "value", Type: "SUMMARY"}},
+		{"missing column", MetricConfig{Name: "other", Type: MetricGauge}},
+		{"missing tag column", MetricConfig{Name: "value", Type: MetricGauge, Tags: []string{"other"}}},
+		{"null value", MetricConfig{Name: "null", Type: MetricCounter}},
+		{"string value", MetricConfig{Name: "string", Type: MetricGauge}},
+	}
+
+	for _, test := range tests {
+		var (
+			eng = newFakeEngine(t, fake.ResponseConfig{Rows: []map[string]any{
+				{"value": 1, "null": (*int64)(nil), "string": "a"},
+			}})
+			conf   = MetricsStageConfig{Query: ch.QueryRef{Name: "metrics"}, Metrics: []MetricConfig{test.metric}}
+			inchan = make(chan Vars, 1)
+		)
+
+		inchan <- Vars{}
+		close(inchan)
+
+		if err := MetricsStage(context.Background(), eng, newTemplates(t, `{{define "metrics"}}SELECT 1{{end}}`), nil, inchan, make(chan Vars, 1), conf); err == nil {
+			t.Errorf("%s: MetricsStage should fail", test.name)
+		}
+	}
+}
+
+// nonZero returns the buckets of a histogram that recorded values.
+func nonZero(buckets map[float64]int64) map[float64]int64 {
+	var res = make(map[float64]int64)
+
+	for upper, count := range buckets {
+		if count > 0 {
+			res[upper] = count
+		}
+	}
+
+	return res
+}
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
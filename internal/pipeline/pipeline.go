@@ -4,22 +4,24 @@ import (
 	"context"
 	"fmt"
 	"strconv"
-	"text/template"
+	"time"
 
 	"github.com/agnosticeng/agt/internal/engine"
 	"github.com/agnosticeng/agt/internal/utils"
 	"github.com/agnosticeng/tallyctx"
 	"github.com/google/uuid"
 	"github.com/samber/lo"
+	"github.com/uber-go/tally/v4"
 	slogctx "github.com/veqryn/slog-context"
 	"golang.org/x/sync/errgroup"
 )
 
 type PipelineConfig struct {
-	Init      InitConfig
-	Source    SourceConfig
-	Stages    []StageConfig
-	Finalizer FinalizerConfig
+	Init          InitConfig
+	Source        SourceConfig
+	Stages        []StageConfig
+	Finalizer     FinalizerConfig
+	QueryComments bool
 }
 
 func (conf PipelineConfig) WithDefaults() PipelineConfig {
@@ -30,18 +32,48 @@ func (conf PipelineConfig) WithDefaults() PipelineConfig {
 
 func Run(
 	ctx context.Context,
-	engine engine.Engine,
-	tmpl *template.Template,
+	engines *engine.Engines,
+	templates *utils.TemplateStore,
 	vars map[string]interface{},
 	conf PipelineConfig,
 ) error {
-	var logger = slogctx.FromCtx(ctx)
+	var (
+		logger = slogctx.FromCtx(ctx)
+		state  = stateFromContext(ctx)
+	)
+
 	defer logger.Info("pipeline finished running")
 
 	if len(conf.Stages) == 0 {
 		return fmt.Errorf("pipeline must have at leats 1 stage")
 	}
 
+	initEngine, err := engines.Get(conf.Init.Engine)
+
+	if err != nil {
+		return fmt.Errorf("init: %w", err)
+	}
+
+	sourceEngine, err := engines.Get(conf.Source.Engine)
+
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+
+	finalizerEngine, err := engines.Get(conf.Finalizer.Engine)
+
+	if err != nil {
+		return fmt.Errorf("finalizer: %w", err)
+	}
+
+	var stagesEngines = make([]engine.Engine, len(conf.Stages))
+
+	for i, stageConf := range conf.Stages {
+		if stagesEngines[i], err = engines.Get(stageConf.Engine); err != nil {
+			return fmt.Errorf("%s: %w", stageName(i), err)
+		}
+	}
+
 	runUUID, err := uuid.NewV7()
 
 	if err != nil {
@@ -49,8 +81,10 @@ func Run(
 	}
 
 	vars["UUID"] = runUUID.String()
+	ctx = withRun(ctx, runUUID.String(), conf.QueryComments)
+	state.start(runUUID.String())
 
-	initVars, err := Init(ctx, engine, tmpl, vars, conf.Init)
+	initVars, err := Init(withStage(ctx, "init"), initEngine, templates, vars, conf.Init)
 
 	if err != nil {
 		return err
@@ -58,56 +92,90 @@ func Run(
 
 	vars = utils.MergeMaps(vars, initVars)
 
+	state.setInitialized()
 	logger.Info("pipeline initialized")
 
 	var (
-		group, groupctx = errgroup.WithContext(ctx)
-		sourceOutChan   = make(chan Vars, 3)
-		lastOutChan     = sourceOutChan
+		group, groupctx  = errgroup.WithContext(ctx)
+		metricsScope     = tallyctx.FromContextOrNoop(groupctx)
+		sourceScope      = metricsScope.SubScope("source")
+		finalizerScope   = metricsScope.SubScope("finalizer")
+		sourceMetrics    = NewStageMetrics(sourceScope)
+		finalizerMetrics = NewStageMetrics(finalizerScope)
+		stageScopes      = lo.Map(conf.Stages, func(_ StageConfig, i int) tally.Scope {
+			return metricsScope.SubScope("stage").Tagged(map[string]string{"stage": strconv.FormatInt(int64(i), 10)})
+		})
+		stagesMetrics = lo.Map(stageScopes, func(scope tally.Scope, _ int) *StageMetrics { return NewStageMetrics(scope) })
+		stagesStates  = lo.Map(conf.Stages, func(conf StageConfig, i int) *stageState { return state.addStage(stageName(i), conf.Type()) })
+		sourceRawChan = make(chan Vars)
+		sourceOutChan = make(chan Vars, 3)
+		lastOutChan   = sourceOutChan
+		queues        = []queue{{C: sourceOutChan, Metrics: stagesMetrics[0]}}
 	)
 
 	group.Go(func() error {
-		defer close(sourceOutChan)
+		defer close(sourceRawChan)
 
-		var sourceCtx = tallyctx.NewContext(groupctx, tallyctx.FromContextOrNoop(groupctx).SubScope("source"))
+		var sourceCtx = tallyctx.NewContext(withStage(groupctx, "source"), sourceScope)
 
 		return Source(
 			sourceCtx,
-			engine,
-			tmpl,
+			sourceEngine,
+			templates,
 			vars,
-			sourceOutChan,
+			sourceRawChan,
 			conf.Source,
 		)
 	})
 
+	group.Go(func() error {
+		return relay(groupctx, sourceRawChan, sourceOutChan, sourceMetrics, stagesMetrics[0], nil, stagesStates[0], stageName(0))
+	})
+
 	for i, procConfig := range conf.Stages {
 		var (
-			inchan  = lastOutChan
-			outchan = make(chan Vars, procConfig.ChanSize)
+			inchan      = lastOutChan
+			rawChan     = make(chan Vars)
+			outchan     = make(chan Vars, procConfig.ChanSize)
+			nextMetrics = finalizerMetrics
+			nextState   *stageState
+			nextName    = "finalizer"
 		)
 
+		if i < len(conf.Stages)-1 {
+			nextMetrics = stagesMetrics[i+1]
+			nextState = stagesStates[i+1]
+			nextName = stageName(i + 1)
+		}
+
+		group.Go(func() error {
+			defer close(rawChan)
+			var procCtx = slogctx.With(withStage(groupctx, strconv.FormatInt(int64(i), 10)), "stage", i)
+			procCtx = tallyctx.NewContext(procCtx, stageScopes[i])
+			procCtx = withStageState(procCtx, stagesStates[i])
+			return Stage(procCtx, stagesEngines[i], templates, vars, inchan, rawChan, procConfig)
+		})
+
 		group.Go(func() error {
-			defer close(outchan)
-			var procCtx = slogctx.With(groupctx, "stage", i)
-			procCtx = tallyctx.NewContext(
-				procCtx, tallyctx.FromContextOrNoop(procCtx).
-					SubScope("stage").
-					Tagged(map[string]string{
-						"stage": strconv.FormatInt(int64(i), 10),
-					}),
-			)
-
-			return Stage(procCtx, engine, tmpl, vars, inchan, outchan, procConfig)
+			return relay(groupctx, rawChan, outchan, stagesMetrics[i], nextMetrics, stagesStates[i], nextState, nextName)
 		})
 
+		queues = append(queues, queue{C: outchan, Metrics: nextMetrics})
 		lastOutChan = outchan
 	}
 
 	group.Go(func() error {
-		var finalizerCtx = tallyctx.NewContext(groupctx, tallyctx.FromContextOrNoop(groupctx).SubScope("finalizer"))
-		return Finalizer(finalizerCtx, lastOutChan, conf.Finalizer)
+		var finalizerCtx = tallyctx.NewContext(withStage(groupctx, "finalizer"), finalizerScope)
+		return Finalizer(finalizerCtx, finalizerEngine, templates, vars, lastOutChan, conf.Finalizer)
 	})
 
+	var samplerCtx, samplerCancel = context.WithCancel(groupctx)
+	defer samplerCancel()
+	go sampleQueues(samplerCtx, queues, time.Second)
+
 	return group.Wait()
 }
+
+func stageName(i int) string {
+	return "stage " + strconv.FormatInt(int64(i), 10)
+}
@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"text/template"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/agnosticeng/concu/mapstream"
+)
+
+func TestRun(t *testing.T) {
+	var (
+		eng = newFakeEngine(t,
+			fake.ResponseConfig{Template: "init", Rows: []map[string]any{{"I": 7}}},
+			fake.ResponseConfig{Template: "source", Times: 1, Rows: []map[string]any{{"N": 1}, {"N": 2}}},
+			fake.ResponseConfig{Template: "step", Pattern: `^SELECT 1 \* 7`, Rows: []map[string]any{{"M": 7}}},
+			fake.ResponseConfig{Template: "step", Pattern: `^SELECT 2 \* 7`, Rows: []map[string]any{{"M": 14}}},
+		)
+		templates = newTemplates(t, `
+			{{define "init"}}SELECT 7 AS I{{end}}
+			{{define "source"}}SELECT {{.I}} FROM {{.TABLE}}{{end}}
+			{{define "step"}}SELECT {{.N}} * {{.I}} AS M{{end}}
+			{{define "done"}}DONE {{.M}}{{end}}
+		`)
+		conf = PipelineConfig{
+			Init:   InitConfig{Queries: []ch.QueryRef{{Name: "init"}}},
+			Source: SourceConfig{Query: ch.QueryRef{Name: "source"}, StopOnEmpty: true},
+			Stages: []StageConfig{{Execute: &ExecuteStageConfig{
+				MapStreamConfig: mapstream.MapStreamConfig{PoolSize: 2},
+				Queries:         []ch.QueryRef{{Name: "step"}},
+			}}},
+			Finalizer: FinalizerConfig{Queries: []ch.QueryRef{{Name: "done"}}},
+		}
+		engines   = &engine.Engines{Default: "default", Engines: map[string]engine.Engine{"default": eng}}
+		mu        sync.Mutex
+		finalized []Vars
+		ctx       = WithFinalizedHandler(context.Background(), func(vars Vars) {
+			mu.Lock()
+			defer mu.Unlock()
+			finalized = append(finalized, withoutTask(vars))
+		})
+	)
+
+	if err := Run(ctx, engines, templates, Vars{"TABLE": "t"}, conf); err != nil {
+		t.Fatal(err)
+	}
+
+	assertQueries(t, eng.CallsFor("init"), "SELECT 7 AS I")
+	assertQueries(t, eng.CallsFor("source"), "SELECT 7 FROM t", "SELECT 7 FROM t")
+	assertQueries(t, eng.CallsFor("step"), "SELECT 1 * 7 AS M", "SELECT 2 * 7 AS M")
+	assertQueries(t, eng.CallsFor("done"), "DONE 7", "DONE 14")
+
+	if want := []Vars{{"M": 7}, {"M": 14}}; !reflect.DeepEqual(finalized, want) {
+		t.Errorf("finalized %v, want %v", finalized, want)
+	}
+
+	var runs = make(map[string]bool)
+
+	for _, call := range eng.Calls() {
+		run, _ := ch.ParseQueryID(call.QueryID)
+		runs[run] = true
+	}
+
+	if len(runs) != 1 || runs[""] {
+		t.Errorf("queries should all belong to the same run: %v", slices.Collect(maps.Keys(runs)))
+	}
+}
+
+func newFakeEngine(t *testing.T, responses ...fake.ResponseConfig) *fake.FakeEngine {
+	t.Helper()
+
+	eng, err := fake.NewFakeEngine(fake.FakeEngineConfig{Responses: responses})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return eng
+}
+
+func newTemplates(t *testing.T, text string) *utils.TemplateStore {
+	t.Helper()
+
+	tmpl, err := template.New("pipeline").Option("missingkey=default").Parse(text)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return utils.NewTemplateStore(tmpl)
+}
+
+// assertQueries checks the SQL of calls, ignoring their order since tasks may be processed concurrently.
+func assertQueries(t *testing.T, calls []fake.Call, want ...string) {
+	t.Helper()
+
+	var got []string
+
+	for _, call := range calls {
+		got = append(got, call.Query)
+	}
+
+	slices.Sort(got)
+	slices.Sort(want)
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got queries %q, want %q", got, want)
+	}
+}
+
+// runStage feeds the stage with inputs, then closes its input and returns what it output.
+func runStage(t *testing.T, f func(ctx context.Context, inchan <-chan Vars, outchan chan<- Vars) error, inputs ...Vars) []Vars {
+	t.Helper()
+
+	var (
+		inchan  = make(chan Vars, len(inputs))
+		outchan = make(chan Vars, 100)
+		outputs []Vars
+	)
+
+	for _, vars := range inputs {
+		inchan <- vars
+	}
+
+	close(inchan)
+
+	if err := f(context.Background(), inchan, outchan); err != nil {
+		t.Fatal(err)
+	}
+
+	close(outchan)
+
+	for vars := range outchan {
+		outputs = append(outputs, withoutTask(vars))
+	}
+
+	return outputs
+}
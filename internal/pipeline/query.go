@@ -9,6 +9,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
 	"github.com/agnosticeng/agt/internal/ch"
 	"github.com/agnosticeng/agt/internal/engine"
@@ -16,6 +17,9 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/samber/lo"
 	slogctx "github.com/veqryn/slog-context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func RunQuery(
@@ -27,15 +31,48 @@ func RunQuery(
 	procMetrics *StageMetrics,
 	queryMetrics *ch.QueryMetrics,
 ) ([]map[string]any, *engine.QueryMetadata, error) {
+	var (
+		idScope = queryIDScopeFromContext(ctx)
+		queryID = idScope.QueryID(query.Name)
+	)
+
+	ctx = slogctx.With(ctx, "query", query.Name, "query_id", queryID)
+
+	ctx, span := tracer.Start(
+		ctx,
+		query.Name,
+		trace.WithAttributes(
+			attribute.String("agt.template", query.Name),
+			attribute.String("clickhouse.query_id", queryID),
+		),
+	)
+	defer span.End()
+
 	var (
 		t0     = time.Now()
-		logger = slogctx.FromCtx(ctx).With("query", query.Name)
+		logger = slogctx.FromCtx(ctx)
 	)
 
 	q, err := utils.RenderTemplate(tmpl, query.Name, vars)
 
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to render %s template: %w", query.Name, err)
+		err = fmt.Errorf("failed to render %s template: %w", query.Name, err)
+		stateFromContext(ctx).recordError(idScope.Stage, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, nil, err
+	}
+
+	span.SetAttributes(attribute.String("agt.query_hash", utils.SHA256Sum(q)))
+
+	ctx = ch.WithQueryID(ctx, queryID)
+
+	if sc := span.SpanContext(); sc.IsValid() {
+		ctx = clickhouse.Context(ctx, clickhouse.WithSpan(sc))
+	}
+
+	if idScope.Comments {
+		q = idScope.Comment(queryID, query.Name) + q
 	}
 
 	if logger.Enabled(ctx, slog.Level(-10)) {
@@ -58,12 +95,24 @@ func RunQuery(
 		"wrote_bytes", md.WroteBytes,
 		"elapsed", md.Elapsed,
 		"memory_peak_usage", humanize.Bytes(md.MemoryPeakUsage),
+		"profile_events", md.ProfileEvents,
 	)
 
+	if md != nil {
+		span.SetAttributes(costToAttributes(*md)...)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+	}
+
 	if err != nil && !query.IgnoreFailure {
 		if ex, ok := lo.ErrorsAs[*proto.Exception](err); !ok || !lo.Contains(query.IgnoreErrorCodes, int(ex.Code)) {
+			span.SetStatus(codes.Error, err.Error())
 			js, _ := json.Marshal(redactSensitiveVars(vars))
-			return nil, nil, fmt.Errorf("failed to execute query %s(vars=%v): %w", query.Name, string(js), err)
+			err = fmt.Errorf("failed to execute query %s(query_id=%s, vars=%v): %w", query.Name, queryID, string(js), err)
+			stateFromContext(ctx).recordError(idScope.Stage, err)
+			return nil, nil, err
 		}
 	}
 
@@ -76,6 +125,10 @@ func RunQuery(
 		queryMetrics.WroteRows.Inc(int64(md.WroteRows))
 		queryMetrics.WroteBytes.Inc(int64(md.WroteBytes))
 		queryMetrics.MemoryPeakUsage.Update(float64(md.MemoryPeakUsage))
+
+		for name, value := range md.ProfileEvents {
+			queryMetrics.ProfileEvent(name).Inc(int64(value))
+		}
 	}
 
 	return res, md, nil
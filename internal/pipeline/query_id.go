@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type queryIDScopeKey struct{}
+
+// queryIDScope holds what RunQuery needs to build a query ID that ties a ClickHouse query back to
+// the run, stage, task and template that issued it.
+type queryIDScope struct {
+	Run      string
+	Stage    string
+	Task     string
+	Comments bool
+}
+
+func queryIDScopeFromContext(ctx context.Context) queryIDScope {
+	scope, _ := ctx.Value(queryIDScopeKey{}).(queryIDScope)
+	return scope
+}
+
+func withQueryIDScope(ctx context.Context, f func(*queryIDScope)) context.Context {
+	var scope = queryIDScopeFromContext(ctx)
+	f(&scope)
+	return context.WithValue(ctx, queryIDScopeKey{}, scope)
+}
+
+func withRun(ctx context.Context, run string, comments bool) context.Context {
+	return withQueryIDScope(ctx, func(scope *queryIDScope) {
+		scope.Run = run
+		scope.Comments = comments
+	})
+}
+
+func withStage(ctx context.Context, stage string) context.Context {
+	return withQueryIDScope(ctx, func(scope *queryIDScope) { scope.Stage = stage })
+}
+
+func withTaskID(ctx context.Context, task string) context.Context {
+	return withQueryIDScope(ctx, func(scope *queryIDScope) { scope.Task = task })
+}
+
+// QueryID builds a query ID of the form agt:<run>:<stage>:<task>:<template>, as parsed by ch.ParseQueryID.
+// Missing parts are replaced by a dash.
+func QueryID(run string, stage string, task string, template string) string {
+	return strings.Join(
+		[]string{
+			"agt",
+			orDash(run),
+			orDash(stage),
+			orDash(task),
+			orDash(template),
+		},
+		":",
+	)
+}
+
+func (scope queryIDScope) QueryID(template string) string {
+	return QueryID(scope.Run, scope.Stage, scope.Task, template)
+}
+
+func (scope queryIDScope) Comment(queryID string, template string) string {
+	return fmt.Sprintf(
+		"/* agt query_id=%s run=%s stage=%s task=%s template=%s */\n",
+		queryID,
+		orDash(scope.Run),
+		orDash(scope.Stage),
+		orDash(scope.Task),
+		orDash(template),
+	)
+}
+
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,31 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/agnosticeng/agt/internal/ch"
+)
+
+func TestQueryID(t *testing.T) {
+	var tests = []struct {
+		run, stage, task, template string
+		want                       string
+	}{
+		{"run", "stage 0", "12", "insert.sql", "agt:run:stage 0:12:insert.sql"},
+		{"run", "", "", "source", "agt:run:-:-:source"},
+		{"run", "init", "", "", "agt:run:init:-:-"},
+		{"", "", "", "", "agt:-:-:-:-"},
+	}
+
+	for _, test := range tests {
+		var queryID = QueryID(test.run, test.stage, test.task, test.template)
+
+		if queryID != test.want {
+			t.Errorf("QueryID(%q, %q, %q, %q) = %q, want %q", test.run, test.stage, test.task, test.template, queryID, test.want)
+		}
+
+		if run, template := ch.ParseQueryID(queryID); run != test.run || template != test.template {
+			t.Errorf("ParseQueryID(%q) = %q, %q, want %q, %q", queryID, run, template, test.run, test.template)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/utils"
+)
+
+// QueryVars is a query of the pipeline along with the vars it is rendered with.
+type QueryVars struct {
+	Component string
+	// Role tells what the query is for when a component runs queries for different purposes,
+	// i.e. enter, condition or leave for the queries of a buffer stage other than its Queries.
+	Role  string
+	Query ch.QueryRef
+	Vars  Vars
+}
+
+// Components lists the selectors accepted by QueriesVars, in pipeline order.
+func (conf PipelineConfig) Components() []string {
+	var res = []string{"init", "source"}
+
+	for i := range conf.Stages {
+		res = append(res, strconv.Itoa(i))
+	}
+
+	return append(res, "finalizer")
+}
+
+// QueriesVars lists the queries of a pipeline component (init, source, finalizer or a stage index)
+// with the vars the pipeline would render them with. commonVars are the vars shared by the whole run
+// (including UUID and init outputs), taskVars those of the task being processed (or of the last row of
+// the previous poll for the source) and batchVars those of the batch a buffer stage has open (LEFT).
+//
+// The vars are built by the same functions the stages use, with one approximation: a buffer stage
+// renders Condition and Leave with the last row returned by its queries, which is only known at run
+// time, so batchVars stands for it here.
+func (conf PipelineConfig) QueriesVars(component string, commonVars Vars, taskVars Vars, batchVars Vars) ([]QueryVars, error) {
+	var (
+		res []QueryVars
+		add = func(role string, query ch.QueryRef, vars Vars) {
+			res = append(res, QueryVars{Component: component, Role: role, Query: query, Vars: vars})
+		}
+	)
+
+	switch component {
+	case "init":
+		for _, query := range conf.Init.Queries {
+			add("", query, commonVars)
+		}
+
+	case "source":
+		add("", conf.Source.Query, sourceVars(commonVars, taskVars))
+
+	case "finalizer":
+		for _, query := range conf.Finalizer.Queries {
+			add("", query, finalizerVars(commonVars, taskVars))
+		}
+
+	default:
+		i, err := strconv.Atoi(component)
+
+		if err != nil || i < 0 || i >= len(conf.Stages) {
+			return nil, fmt.Errorf("unknown pipeline component %s: must be init, source, finalizer or a stage index", component)
+		}
+
+		var stage = conf.Stages[i]
+
+		switch {
+		case stage.Execute != nil:
+			for _, query := range stage.Execute.Queries {
+				add("", query, executeVars(commonVars, taskVars))
+			}
+
+		case stage.Buffer != nil:
+			if stage.Buffer.Enter != nil {
+				add("enter", *stage.Buffer.Enter, bufferEnterVars(commonVars, taskVars))
+			}
+
+			for _, query := range stage.Buffer.Queries {
+				add("", query, bufferQueriesVars(commonVars, batchVars, taskVars))
+			}
+
+			if stage.Buffer.Condition != nil {
+				add("condition", *stage.Buffer.Condition, bufferBatchVars(commonVars, batchVars))
+			}
+
+			if stage.Buffer.Leave != nil {
+				add("leave", *stage.Buffer.Leave, bufferBatchVars(commonVars, batchVars))
+			}
+
+		case stage.Metrics != nil:
+			add("", stage.Metrics.Query, metricsVars(commonVars, taskVars))
+		}
+	}
+
+	return res, nil
+}
+
+// The functions below build the vars each component renders its queries with; the stages and
+// QueriesVars share them so that rendering matches what a run sends to the engine. The task
+// bookkeeping carried in TaskVar is left out: it is not meant for templates, and functions
+// such as toCH cannot render it.
+
+func sourceVars(commonVars Vars, lastRow Vars) Vars {
+	return withoutTask(utils.MergeMaps(commonVars, lastRow))
+}
+
+func executeVars(commonVars Vars, taskVars Vars) Vars {
+	return withoutTask(utils.MergeMaps(commonVars, taskVars))
+}
+
+func bufferEnterVars(commonVars Vars, taskVars Vars) Vars {
+	return withoutTask(utils.MergeMaps(commonVars, taskVars))
+}
+
+func bufferQueriesVars(commonVars Vars, batchVars Vars, taskVars Vars) Vars {
+	return utils.MergeMaps(Vars{"LEFT": withoutTask(batchVars), "RIGHT": withoutTask(taskVars)}, commonVars)
+}
+
+// bufferBatchVars builds the vars of Condition and Leave, batchVars being the last row returned by the
+// buffer queries.
+func bufferBatchVars(commonVars Vars, batchVars Vars) Vars {
+	return withoutTask(utils.MergeMaps(commonVars, batchVars))
+}
+
+func metricsVars(commonVars Vars, taskVars Vars) Vars {
+	return withoutTask(utils.MergeMaps(taskVars, commonVars))
+}
+
+func finalizerVars(commonVars Vars, taskVars Vars) Vars {
+	return withoutTask(utils.MergeMaps(commonVars, taskVars))
+}
@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/utils"
+)
+
+func TestQueriesVarsWithoutTask(t *testing.T) {
+	var (
+		query = ch.QueryRef{Name: "q"}
+		conf  = PipelineConfig{
+			Init:   InitConfig{Queries: []ch.QueryRef{query}},
+			Source: SourceConfig{Query: query},
+			Stages: []StageConfig{
+				{Execute: &ExecuteStageConfig{Queries: []ch.QueryRef{query}}},
+				{Buffer: &BufferStageConfig{Enter: &query, Queries: []ch.QueryRef{query}, Condition: &query, Leave: &query}},
+				{Metrics: &MetricsStageConfig{Query: query}},
+			},
+			Finalizer: FinalizerConfig{Queries: []ch.QueryRef{query}},
+		}
+		taskVars  = WithTask(Vars{"N": 1}, Task{ID: "0"})
+		batchVars = WithTask(Vars{"K": 2}, Task{ID: "1"})
+	)
+
+	for _, component := range conf.Components() {
+		queries, err := conf.QueriesVars(component, Vars{"C": "c"}, taskVars, batchVars)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, query := range queries {
+			// toCH renders whole var maps, such as the LEFT and RIGHT rows of a buffer
+			for _, vars := range []any{query.Vars, query.Vars["LEFT"], query.Vars["RIGHT"]} {
+				if vars, ok := vars.(Vars); ok {
+					if _, found := vars[TaskVar]; found {
+						t.Errorf("%s %s: the task should not be given to templates", component, query.Role)
+					}
+				}
+
+				if _, err := utils.ToClickHouseLiteral(vars); err != nil {
+					t.Errorf("%s %s: %v", component, query.Role, err)
+				}
+			}
+		}
+	}
+
+	if _, found := taskVars[TaskVar]; !found {
+		t.Errorf("the task vars should not be modified")
+	}
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type queue struct {
+	C       chan Vars
+	Metrics *StageMetrics
+}
+
+// relay forwards tasks from a producer's output to its consumer's input queue,
+// accounting for the hand-off on both sides and opening the consumer's span.
+// The tasks a stage has in flight are tracked from the relay feeding it to the relay draining it.
+func relay(
+	ctx context.Context,
+	inchan <-chan Vars,
+	outchan chan<- Vars,
+	from *StageMetrics,
+	to *StageMetrics,
+	fromState *stageState,
+	toState *stageState,
+	toName string,
+) error {
+	defer close(outchan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case vars, open := <-inchan:
+			if !open {
+				return nil
+			}
+
+			var (
+				now  = time.Now()
+				task = TaskFromVars(vars)
+			)
+
+			if !task.StageEnteredAt.IsZero() {
+				from.DwellTime.RecordDuration(now.Sub(task.StageEnteredAt))
+			}
+
+			from.TasksOut.Inc(1)
+			fromState.leave(task.ID)
+			task.StageEnteredAt = now
+
+			if task.StageSpan != nil {
+				task.StageSpan.End()
+				task.StageSpan = nil
+			}
+
+			if task.Span != nil {
+				_, task.StageSpan = tracer.Start(trace.ContextWithSpan(ctx, task.Span), toName)
+			}
+
+			vars = WithTask(vars, task)
+			toState.enter(vars)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case outchan <- vars:
+				to.TasksIn.Inc(1)
+			}
+		}
+	}
+}
+
+func sampleQueues(ctx context.Context, queues []queue, interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, q := range queues {
+			q.Metrics.QueueLength.Update(float64(len(q.C)))
+			q.Metrics.QueueCapacity.Update(float64(cap(q.C)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
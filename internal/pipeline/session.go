@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"text/template"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine"
+)
+
+// RunQueriesInSession is like RunQueries but, when a session mode is set, runs all the queries in a single
+// ClickHouse session so that they can share session-scoped state such as temporary tables.
+func RunQueriesInSession(
+	ctx context.Context,
+	eng engine.Engine,
+	mode engine.SessionMode,
+	tmpl *template.Template,
+	queries []ch.QueryRef,
+	vars map[string]any,
+	procMetrics *StageMetrics,
+	queriesMetrics []*ch.QueryMetrics,
+) ([]map[string]any, *engine.QueryMetadata, error) {
+	eng, closeSession, err := WithSession(ctx, eng, mode)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer closeSession()
+	return RunQueries(ctx, eng, tmpl, queries, vars, procMetrics, queriesMetrics)
+}
+
+// WithSession returns an engine running every query in a new session, and the function closing it.
+// Without a session mode, the engine is returned as is.
+func WithSession(ctx context.Context, eng engine.Engine, mode engine.SessionMode) (engine.Engine, func() error, error) {
+	if len(mode) == 0 {
+		return eng, func() error { return nil }, nil
+	}
+
+	session, err := engine.OpenSession(ctx, eng, mode)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open session: %w", err)
+	}
+
+	return &sessionEngine{Engine: eng, session: session}, session.Close, nil
+}
+
+type sessionEngine struct {
+	engine.Engine
+	session engine.Session
+}
+
+func (eng *sessionEngine) Query(ctx context.Context, query string, args ...any) ([]map[string]any, *engine.QueryMetadata, error) {
+	return eng.session.Query(ctx, query, args...)
+}
@@ -2,17 +2,19 @@ package pipeline
 
 import (
 	"context"
-	"text/template"
+	"strconv"
 	"time"
 
-	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/agnosticeng/agt/internal/ch"
 	"github.com/agnosticeng/agt/internal/engine"
 	"github.com/agnosticeng/agt/internal/utils"
 	slogctx "github.com/veqryn/slog-context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type SourceConfig struct {
+	Engine             string
 	Query              ch.QueryRef
 	PollInterval       time.Duration
 	StopAfter          int
@@ -23,36 +25,51 @@ type SourceConfig struct {
 func Source(
 	ctx context.Context,
 	engine engine.Engine,
-	tmpl *template.Template,
+	templates *utils.TemplateStore,
 	commonVars map[string]interface{},
 	outchan chan<- Vars,
 	conf SourceConfig,
 ) error {
 	var (
 		logger           = slogctx.FromCtx(ctx)
+		state            = stateFromContext(ctx)
 		nextWaitDuration time.Duration
 		lastRow          map[string]any
 		iterations       int
+		tasks            int
 	)
 
 	logger.Debug("started")
 	defer logger.Debug("stopped")
 
 	if len(conf.ClickhouseSettings) > 0 {
-		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(ch.NormalizeSettings(conf.ClickhouseSettings)))
+		ctx = ch.WithSettings(ctx, conf.ClickhouseSettings)
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-state.sourceStopped():
+			logger.Info("source stopped on request")
+			return nil
 		case <-time.After(nextWaitDuration):
+			if state.Paused() {
+				logger.Info("source paused")
+
+				if !state.waitResumed(ctx) {
+					return nil
+				}
+
+				logger.Info("source resumed")
+			}
+
 			rows, _, err := RunQuery(
-				ctx,
+				withTaskID(ctx, "i"+strconv.Itoa(iterations)),
 				engine,
-				tmpl,
+				templates.Load(),
 				conf.Query,
-				utils.MergeMaps(commonVars, lastRow),
+				sourceVars(commonVars, lastRow),
 				nil,
 				nil,
 			)
@@ -61,6 +78,8 @@ func Source(
 				return err
 			}
 
+			state.sourcePolled(rows)
+
 			if len(rows) == 0 {
 				if conf.StopOnEmpty {
 					return nil
@@ -71,11 +90,23 @@ func Source(
 			}
 
 			for _, row := range rows {
+				var task = Task{ID: strconv.Itoa(tasks), EmittedAt: time.Now()}
+
+				_, task.Span = tracer.Start(
+					ctx,
+					"task",
+					trace.WithNewRoot(),
+					trace.WithAttributes(attribute.String("agt.task", task.ID)),
+				)
+
 				select {
 				case <-ctx.Done():
+					task.Span.End()
 					return nil
-				case outchan <- row:
+				case outchan <- WithTask(row, task):
 				}
+
+				tasks++
 			}
 
 			iterations++
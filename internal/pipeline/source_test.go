@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/agnosticeng/agt/internal/ch"
+	"github.com/agnosticeng/agt/internal/engine/impl/fake"
+)
+
+func TestSource(t *testing.T) {
+	var tests = []struct {
+		name    string
+		conf    SourceConfig
+		queries []string
+		outputs []Vars
+	}{
+		{
+			name:    "stop on empty",
+			conf:    SourceConfig{StopOnEmpty: true},
+			queries: []string{"SELECT AFTER 0", "SELECT AFTER 2", "SELECT AFTER 3"},
+			outputs: []Vars{{"K": 1}, {"K": 2}, {"K": 3}},
+		},
+		{
+			name:    "stop after",
+			conf:    SourceConfig{StopAfter: 1},
+			queries: []string{"SELECT AFTER 0"},
+			outputs: []Vars{{"K": 1}, {"K": 2}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				eng = newFakeEngine(t,
+					fake.ResponseConfig{Pattern: `AFTER 0$`, Rows: []map[string]any{{"K": 1}, {"K": 2}}},
+					fake.ResponseConfig{Pattern: `AFTER 2$`, Rows: []map[string]any{{"K": 3}}},
+				)
+				templates = newTemplates(t, `{{define "source"}}SELECT AFTER {{.K}}{{end}}`)
+				conf      = test.conf
+			)
+
+			conf.Query = ch.QueryRef{Name: "source"}
+
+			// the source has no input: runStage only collects its output
+			var outputs = runStage(t, func(ctx context.Context, _ <-chan Vars, outchan chan<- Vars) error {
+				return Source(ctx, eng, templates, Vars{"K": 0}, outchan, conf)
+			})
+
+			assertQueries(t, eng.Calls(), test.queries...)
+
+			if !reflect.DeepEqual(outputs, test.outputs) {
+				t.Errorf("got outputs %v, want %v", outputs, test.outputs)
+			}
+		})
+	}
+}
@@ -3,13 +3,15 @@ package pipeline
 import (
 	"context"
 	"fmt"
-	"text/template"
+	"time"
 
 	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/utils"
 	"github.com/uber-go/tally/v4"
 )
 
 type StageConfig struct {
+	Engine   string
 	ChanSize int
 
 	Execute *ExecuteStageConfig
@@ -27,10 +29,27 @@ func (conf StageConfig) WithDefaults() StageConfig {
 	return conf
 }
 
+func (conf StageConfig) Type() string {
+	switch {
+	case conf.Execute != nil:
+		return "execute"
+	case conf.Debug != nil:
+		return "debug"
+	case conf.Sleep != nil:
+		return "sleep"
+	case conf.Buffer != nil:
+		return "buffer"
+	case conf.Metrics != nil:
+		return "metrics"
+	default:
+		return "unknown"
+	}
+}
+
 func Stage(
 	ctx context.Context,
 	engine engine.Engine,
-	tmpl *template.Template,
+	templates *utils.TemplateStore,
 	commonVars map[string]any,
 	inchan <-chan Vars,
 	outchan chan<- Vars,
@@ -38,26 +57,39 @@ func Stage(
 ) error {
 	switch {
 	case conf.Execute != nil:
-		return ExecuteStage(ctx, engine, tmpl, commonVars, inchan, outchan, *conf.Execute)
+		return ExecuteStage(ctx, engine, templates, commonVars, inchan, outchan, *conf.Execute)
 	case conf.Debug != nil:
 		return DebugStage(ctx, inchan, outchan, *conf.Debug)
 	case conf.Sleep != nil:
 		return SleepStage(ctx, inchan, outchan, *conf.Sleep)
 	case conf.Buffer != nil:
-		return BufferStage(ctx, engine, tmpl, commonVars, inchan, outchan, *conf.Buffer)
+		return BufferStage(ctx, engine, templates, commonVars, inchan, outchan, *conf.Buffer)
 	case conf.Metrics != nil:
-		return MetricsStage(ctx, engine, tmpl, commonVars, inchan, outchan, *conf.Metrics)
+		return MetricsStage(ctx, engine, templates, commonVars, inchan, outchan, *conf.Metrics)
 	default:
 		return fmt.Errorf("unknwon stage type")
 	}
 }
 
 type StageMetrics struct {
-	Active tally.Gauge
+	Active        tally.Gauge
+	TasksIn       tally.Counter
+	TasksOut      tally.Counter
+	DwellTime     tally.Histogram
+	QueueLength   tally.Gauge
+	QueueCapacity tally.Gauge
 }
 
 func NewStageMetrics(scope tally.Scope) *StageMetrics {
 	return &StageMetrics{
-		Active: scope.Gauge("active"),
+		Active:   scope.Gauge("active"),
+		TasksIn:  scope.Counter("tasks_in"),
+		TasksOut: scope.Counter("tasks_out"),
+		DwellTime: scope.Histogram(
+			"dwell_time",
+			tally.MustMakeExponentialDurationBuckets(100*time.Millisecond, 2, 12),
+		),
+		QueueLength:   scope.Gauge("queue_length"),
+		QueueCapacity: scope.Gauge("queue_capacity"),
 	}
 }
@@ -0,0 +1,363 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+const maxRecentErrors = 20
+
+type stateKey struct{}
+
+// State tracks what a running pipeline is doing so that it can be inspected and controlled from outside,
+// e.g. through the admin HTTP API. All methods are safe to call on a nil *State.
+type State struct {
+	mu          sync.Mutex
+	resumed     chan struct{}
+	stopped     chan struct{}
+	run         string
+	startedAt   time.Time
+	initialized bool
+	source      SourceStatus
+	stages      []*stageState
+	errors      []ErrorStatus
+}
+
+type SourceStatus struct {
+	Iterations int            `json:"iterations"`
+	Tasks      int            `json:"tasks"`
+	LastRow    map[string]any `json:"last_row,omitempty"`
+	LastPollAt time.Time      `json:"last_poll_at,omitzero"`
+}
+
+type BufferStatus struct {
+	Rows     int           `json:"rows"`
+	Tasks    int           `json:"tasks"`
+	OpenedAt time.Time     `json:"opened_at"`
+	Age      time.Duration `json:"age"`
+}
+
+type StageStatus struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	InFlight []Vars        `json:"in_flight"`
+	Buffer   *BufferStatus `json:"buffer,omitempty"`
+}
+
+type ErrorStatus struct {
+	Time  time.Time `json:"time"`
+	Stage string    `json:"stage"`
+	Error string    `json:"error"`
+}
+
+type Status struct {
+	Run           string        `json:"run"`
+	StartedAt     time.Time     `json:"started_at,omitzero"`
+	Initialized   bool          `json:"initialized"`
+	Paused        bool          `json:"paused"`
+	SourceStopped bool          `json:"source_stopped"`
+	Source        SourceStatus  `json:"source"`
+	Stages        []StageStatus `json:"stages"`
+	Errors        []ErrorStatus `json:"errors"`
+}
+
+func NewState() *State {
+	return &State{stopped: make(chan struct{})}
+}
+
+func WithState(ctx context.Context, state *State) context.Context {
+	return context.WithValue(ctx, stateKey{}, state)
+}
+
+func stateFromContext(ctx context.Context) *State {
+	state, _ := ctx.Value(stateKey{}).(*State)
+	return state
+}
+
+// Initialized reports whether the pipeline went through its init phase and is processing tasks.
+func (s *State) Initialized() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.initialized
+}
+
+func (s *State) Status() Status {
+	if s == nil {
+		return Status{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var status = Status{
+		Run:           s.run,
+		StartedAt:     s.startedAt,
+		Initialized:   s.initialized,
+		Paused:        s.resumed != nil,
+		SourceStopped: isClosed(s.stopped),
+		Source:        s.source,
+		Errors:        append([]ErrorStatus{}, s.errors...),
+	}
+
+	if s.source.LastRow != nil {
+		status.Source.LastRow = redactSensitiveVars(s.source.LastRow)
+	}
+
+	for _, stage := range s.stages {
+		status.Stages = append(status.Stages, stage.status())
+	}
+
+	return status
+}
+
+// Pause stops the source from polling new rows until Resume is called.
+// Tasks already emitted keep flowing through the stages, and open buffers are kept.
+func (s *State) Pause() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resumed == nil {
+		s.resumed = make(chan struct{})
+	}
+}
+
+func (s *State) Resume() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+	}
+}
+
+func (s *State) Paused() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resumed != nil
+}
+
+// StopSource makes the source return as if it had run out of rows, so that the pipeline drains and exits.
+func (s *State) StopSource() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !isClosed(s.stopped) {
+		close(s.stopped)
+	}
+}
+
+// sourceStopped returns a channel closed once StopSource is called.
+func (s *State) sourceStopped() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+
+	return s.stopped
+}
+
+// waitResumed blocks while the pipeline is paused.
+// It returns false if the source was stopped or the context cancelled in the meantime.
+func (s *State) waitResumed(ctx context.Context) bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	var resumed = s.resumed
+	s.mu.Unlock()
+
+	if resumed == nil {
+		return true
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-s.stopped:
+		return false
+	case <-resumed:
+		return true
+	}
+}
+
+func (s *State) start(run string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.run = run
+	s.startedAt = time.Now()
+	s.initialized = false
+	s.source = SourceStatus{}
+	s.stages = nil
+}
+
+func (s *State) setInitialized() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initialized = true
+}
+
+func (s *State) addStage(name string, typ string) *stageState {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stage = &stageState{name: name, typ: typ, inFlight: make(map[string]Vars)}
+	s.stages = append(s.stages, stage)
+	return stage
+}
+
+func (s *State) sourcePolled(rows []map[string]any) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source.LastPollAt = time.Now()
+
+	if len(rows) > 0 {
+		s.source.Iterations++
+		s.source.Tasks += len(rows)
+		s.source.LastRow = rows[len(rows)-1]
+	}
+}
+
+func (s *State) recordError(stage string, err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.errors = append(s.errors, ErrorStatus{Time: time.Now(), Stage: stage, Error: err.Error()})
+
+	if len(s.errors) > maxRecentErrors {
+		s.errors = s.errors[len(s.errors)-maxRecentErrors:]
+	}
+}
+
+type stageStateKey struct{}
+
+// stageState holds the tasks a stage has been handed and not yet emitted, whether they still wait in
+// its input queue or are being processed. All methods are safe to call on a nil *stageState.
+type stageState struct {
+	mu       sync.Mutex
+	name     string
+	typ      string
+	inFlight map[string]Vars
+	buffer   *BufferStatus
+}
+
+func withStageState(ctx context.Context, stage *stageState) context.Context {
+	return context.WithValue(ctx, stageStateKey{}, stage)
+}
+
+func stageStateFromContext(ctx context.Context) *stageState {
+	stage, _ := ctx.Value(stageStateKey{}).(*stageState)
+	return stage
+}
+
+func (s *stageState) enter(vars Vars) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight[TaskFromVars(vars).ID] = vars
+}
+
+func (s *stageState) leave(taskID string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, taskID)
+}
+
+// setBuffer records the state of the batch a buffer stage holds open; nil means no batch is open.
+func (s *stageState) setBuffer(buffer *BufferStatus) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffer = buffer
+}
+
+func (s *stageState) status() StageStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var status = StageStatus{
+		Name:     s.name,
+		Type:     s.typ,
+		InFlight: make([]Vars, 0, len(s.inFlight)),
+	}
+
+	for _, vars := range s.inFlight {
+		status.InFlight = append(status.InFlight, redactSensitiveVars(vars))
+	}
+
+	slices.SortFunc(status.InFlight, func(a, b Vars) int {
+		return cmp.Compare(TaskFromVars(a).EmittedAt.UnixNano(), TaskFromVars(b).EmittedAt.UnixNano())
+	})
+
+	if s.buffer != nil {
+		var buffer = *s.buffer
+		buffer.Age = time.Since(buffer.OpenedAt)
+		status.Buffer = &buffer
+	}
+
+	return status
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
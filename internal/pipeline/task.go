@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/agnosticeng/agt/internal/engine"
+	"github.com/agnosticeng/agt/internal/utils"
+	"github.com/dustin/go-humanize"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TaskVar is the reserved var under which the pipeline carries its own per-task bookkeeping from stage to stage.
+const TaskVar = "_agt"
+
+var tracer = otel.Tracer("github.com/agnosticeng/agt/internal/pipeline")
+
+type Task struct {
+	ID             string
+	EmittedAt      time.Time
+	StageEnteredAt time.Time
+	Cost           engine.QueryMetadata
+	Span           trace.Span `json:"-"`
+	StageSpan      trace.Span `json:"-"`
+}
+
+func TaskFromVars(vars Vars) Task {
+	task, _ := vars[TaskVar].(Task)
+	return task
+}
+
+func WithTask(vars Vars, task Task) Vars {
+	return utils.MergeMaps(vars, Vars{TaskVar: task})
+}
+
+// withoutTask returns vars without their task, cloning them only if they carry one.
+func withoutTask(vars Vars) Vars {
+	if _, found := vars[TaskVar]; !found {
+		return vars
+	}
+
+	vars = maps.Clone(vars)
+	delete(vars, TaskVar)
+	return vars
+}
+
+func (task Task) AddCost(md *engine.QueryMetadata) Task {
+	var cost engine.QueryMetadata
+
+	cost.Merge(&task.Cost)
+
+	if md != nil {
+		cost.Merge(md)
+	}
+
+	task.Cost = cost
+	return task
+}
+
+// Context returns a context carrying the task ID and the innermost span of the task, so that
+// queries run on its behalf are identified, traced as its children and routed with affinity.
+func (task Task) Context(ctx context.Context) context.Context {
+	if len(task.ID) > 0 {
+		ctx = withTaskID(ctx, task.ID)
+		ctx = engine.WithAffinity(ctx, queryIDScopeFromContext(ctx).Run+":"+task.ID)
+	}
+
+	switch {
+	case task.StageSpan != nil:
+		return trace.ContextWithSpan(ctx, task.StageSpan)
+	case task.Span != nil:
+		return trace.ContextWithSpan(ctx, task.Span)
+	default:
+		return ctx
+	}
+}
+
+// Merge folds another task into this one, as when a buffer batches several tasks together.
+// The merged task is as old as the oldest of the two and keeps its own ID and span;
+// the spans of the other task end here.
+func (task Task) Merge(other Task) Task {
+	task = task.AddCost(&other.Cost)
+	task.EmittedAt = minTime(task.EmittedAt, other.EmittedAt)
+	task.StageEnteredAt = minTime(task.StageEnteredAt, other.StageEnteredAt)
+
+	if len(task.ID) == 0 {
+		task.ID = other.ID
+	}
+
+	if task.Span == nil {
+		task.Span, task.StageSpan = other.Span, other.StageSpan
+		return task
+	}
+
+	var mergedInto = trace.WithAttributes(attribute.String("agt.merged_into", task.Span.SpanContext().TraceID().String()))
+
+	if other.StageSpan != nil {
+		other.StageSpan.End()
+	}
+
+	if other.Span != nil {
+		other.Span.AddEvent("merged", mergedInto)
+		other.Span.End()
+	}
+
+	return task
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	switch {
+	case a.IsZero():
+		return b
+	case b.IsZero():
+		return a
+	case b.Before(a):
+		return b
+	default:
+		return a
+	}
+}
+
+func costToKeyValues(cost engine.QueryMetadata) []any {
+	return []any{
+		"cost_rows", cost.Rows,
+		"cost_bytes", cost.Bytes,
+		"cost_wrote_rows", cost.WroteRows,
+		"cost_wrote_bytes", cost.WroteBytes,
+		"cost_elapsed", cost.Elapsed,
+		"cost_memory_peak_usage", humanize.Bytes(cost.MemoryPeakUsage),
+	}
+}
+
+func costToAttributes(cost engine.QueryMetadata) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int64("agt.rows", int64(cost.Rows)),
+		attribute.Int64("agt.bytes", int64(cost.Bytes)),
+		attribute.Int64("agt.total_rows", int64(cost.TotalRows)),
+		attribute.Int64("agt.wrote_rows", int64(cost.WroteRows)),
+		attribute.Int64("agt.wrote_bytes", int64(cost.WroteBytes)),
+		attribute.Int64("agt.elapsed_ms", cost.Elapsed.Milliseconds()),
+		attribute.Int64("agt.memory_peak_usage", int64(cost.MemoryPeakUsage)),
+	}
+}
@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"text/template"
+
+	"github.com/agnosticeng/agt/internal/ch"
+)
+
+// QueryRefs lists every query referenced by the pipeline.
+func (conf PipelineConfig) QueryRefs() []ch.QueryRef {
+	var refs []ch.QueryRef
+
+	refs = append(refs, conf.Init.Queries...)
+	refs = append(refs, conf.Source.Query)
+
+	for _, stage := range conf.Stages {
+		switch {
+		case stage.Execute != nil:
+			refs = append(refs, stage.Execute.Queries...)
+		case stage.Buffer != nil:
+			for _, ref := range []*ch.QueryRef{stage.Buffer.Enter, stage.Buffer.Leave, stage.Buffer.Condition} {
+				if ref != nil {
+					refs = append(refs, *ref)
+				}
+			}
+
+			refs = append(refs, stage.Buffer.Queries...)
+		case stage.Metrics != nil:
+			refs = append(refs, stage.Metrics.Query)
+		}
+	}
+
+	refs = append(refs, conf.Finalizer.Queries...)
+	return refs
+}
+
+// ValidateTemplates checks that every query referenced by the pipeline resolves to a parsed template.
+func ValidateTemplates(tmpl *template.Template, conf PipelineConfig) error {
+	var errs []error
+
+	for _, ref := range conf.QueryRefs() {
+		if tmpl.Lookup(ref.Name) == nil {
+			errs = append(errs, fmt.Errorf("template %s not found", ref.Name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -10,6 +10,10 @@ func varsToKeyValues(m map[string]any) []any {
 	var res []any
 
 	for k, v := range m {
+		if k == TaskVar {
+			continue
+		}
+
 		lv, err := utils.ToClickHouseLiteral(v)
 
 		if err != nil {
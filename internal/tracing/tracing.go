@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"github.com/agnosticeng/agt/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type OtlpConfig struct {
+	Endpoint    string
+	EndpointURL string
+	Insecure    bool
+	Headers     map[string]string
+}
+
+type FileConfig struct {
+	Path   string
+	Pretty bool
+}
+
+type TracingConfig struct {
+	ServiceName string
+	// SampleRatio is the fraction of traces sampled, from 0 (none) to 1 (all, the default when unset).
+	SampleRatio *float64
+	Otlp        *OtlpConfig
+	File        *FileConfig
+}
+
+func (conf TracingConfig) WithDefaults() TracingConfig {
+	if len(conf.ServiceName) == 0 {
+		conf.ServiceName = "agt"
+	}
+
+	if conf.SampleRatio == nil {
+		conf.SampleRatio = utils.Ptr(1.0)
+	}
+
+	return conf
+}
+
+// Setup installs a global tracer provider exporting spans as configured.
+// When no exporter is configured, the global no-op provider is left in place.
+// The returned function flushes pending spans and must be called before exiting.
+func Setup(ctx context.Context, conf TracingConfig) (func(context.Context) error, error) {
+	var exporters []sdktrace.SpanExporter
+
+	conf = conf.WithDefaults()
+
+	if conf.Otlp != nil {
+		var opts []otlptracehttp.Option
+
+		if len(conf.Otlp.Endpoint) > 0 {
+			opts = append(opts, otlptracehttp.WithEndpoint(conf.Otlp.Endpoint))
+		}
+
+		if len(conf.Otlp.EndpointURL) > 0 {
+			opts = append(opts, otlptracehttp.WithEndpointURL(conf.Otlp.EndpointURL))
+		}
+
+		if conf.Otlp.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		if len(conf.Otlp.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(conf.Otlp.Headers))
+		}
+
+		exp, err := otlptracehttp.New(ctx, opts...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		exporters = append(exporters, exp)
+	}
+
+	if conf.File != nil {
+		f, err := os.Create(conf.File.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var opts = []stdouttrace.Option{stdouttrace.WithWriter(f)}
+
+		if conf.File.Pretty {
+			opts = append(opts, stdouttrace.WithPrettyPrint())
+		}
+
+		exp, err := stdouttrace.New(opts...)
+
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		exporters = append(exporters, &fileExporter{SpanExporter: exp, f: f})
+	}
+
+	if len(exporters) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts = []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", conf.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(*conf.SampleRatio))),
+	}
+
+	for _, exp := range exporters {
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+
+	var tp = sdktrace.NewTracerProvider(opts...)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return tp.Shutdown, nil
+}
+
+type fileExporter struct {
+	sdktrace.SpanExporter
+	f *os.File
+}
+
+func (exp *fileExporter) Shutdown(ctx context.Context) error {
+	defer exp.f.Close()
+	return exp.SpanExporter.Shutdown(ctx)
+}
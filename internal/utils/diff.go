@@ -0,0 +1,20 @@
+package utils
+
+import "github.com/pmezard/go-difflib/difflib"
+
+// Diff returns a unified diff turning expected into actual, or an empty string if they are equal.
+func Diff(name string, expected string, actual string) string {
+	if expected == actual {
+		return ""
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(expected),
+		B:        difflib.SplitLines(actual),
+		FromFile: name + " (expected)",
+		ToFile:   name + " (actual)",
+		Context:  3,
+	})
+
+	return diff
+}
@@ -3,8 +3,13 @@ package utils
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"net/url"
 	"path/filepath"
+	"slices"
+	"sync/atomic"
 	"text/template"
 
 	"github.com/Masterminds/sprig"
@@ -58,3 +63,62 @@ func LoadTemplates(ctx context.Context, target *url.URL) (*template.Template, er
 
 	return tmpl, nil
 }
+
+// TemplatesFingerprint hashes the listing of the templates under target, so that a change to any of them
+// can be detected without reading their content.
+func TemplatesFingerprint(ctx context.Context, target *url.URL) (string, error) {
+	var os = objstr.FromContextOrDefault(ctx)
+
+	files, err := os.ListPrefix(ctx, target)
+
+	if err != nil {
+		return "", err
+	}
+
+	var entries []string
+
+	for _, file := range files {
+		if filepath.Ext(file.URL.Path) != ".sql" {
+			continue
+		}
+
+		var entry = file.URL.String()
+
+		if file.Metadata != nil {
+			entry = fmt.Sprintf("%s %d %d %s", entry, file.Metadata.Size, file.Metadata.ModificationDate.UnixNano(), file.Metadata.ETag)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	slices.Sort(entries)
+
+	var h = sha256.New()
+
+	for _, entry := range entries {
+		h.Write([]byte(entry))
+		h.Write([]byte{'\n'})
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// TemplateStore holds the current set of templates and lets it be swapped while the pipeline runs.
+// Users take a snapshot with Load for each unit of work, so that a swap never happens halfway through it.
+type TemplateStore struct {
+	p atomic.Pointer[template.Template]
+}
+
+func NewTemplateStore(tmpl *template.Template) *TemplateStore {
+	var store TemplateStore
+	store.p.Store(tmpl)
+	return &store
+}
+
+func (store *TemplateStore) Load() *template.Template {
+	return store.p.Load()
+}
+
+func (store *TemplateStore) Store(tmpl *template.Template) {
+	store.p.Store(tmpl)
+}
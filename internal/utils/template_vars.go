@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"maps"
+	"slices"
+	"text/template"
+	"text/template/parse"
+)
+
+// TemplateVars lists the top-level vars a template reads from the data it is executed with, including
+// through the templates it invokes with that same data. Fields read once the dot has moved (inside
+// range or with blocks) are fields of nested values, not vars, and are left out.
+func TemplateVars(tmpl *template.Template, name string) []string {
+	var w = templateVarsWalker{
+		tmpl:    tmpl,
+		vars:    make(map[string]struct{}),
+		visited: make(map[string]bool),
+	}
+
+	w.template(name)
+	return slices.Sorted(maps.Keys(w.vars))
+}
+
+type templateVarsWalker struct {
+	tmpl    *template.Template
+	vars    map[string]struct{}
+	visited map[string]bool
+}
+
+func (w *templateVarsWalker) template(name string) {
+	var t = w.tmpl.Lookup(name)
+
+	if t == nil || t.Tree == nil || w.visited[name] {
+		return
+	}
+
+	w.visited[name] = true
+	w.walk(t.Tree.Root, true)
+}
+
+// walk collects the vars read by node, root telling whether the dot is still the data of the template.
+func (w *templateVarsWalker) walk(node parse.Node, root bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, child := range n.Nodes {
+			w.walk(child, root)
+		}
+
+	case *parse.ActionNode:
+		w.walk(n.Pipe, root)
+
+	case *parse.IfNode:
+		w.walk(n.Pipe, root)
+		w.walk(n.List, root)
+		w.walk(n.ElseList, root)
+
+	case *parse.RangeNode:
+		w.walk(n.Pipe, root)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, root)
+
+	case *parse.WithNode:
+		w.walk(n.Pipe, root)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, root)
+
+	case *parse.TemplateNode:
+		w.walk(n.Pipe, root)
+
+		if root && n.Pipe != nil && len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1 {
+			if _, ok := n.Pipe.Cmds[0].Args[0].(*parse.DotNode); ok {
+				w.template(n.Name)
+			}
+		}
+
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+
+		for _, cmd := range n.Cmds {
+			w.walk(cmd, root)
+		}
+
+	case *parse.CommandNode:
+		// index . "key" reads a var as well
+		if len(n.Args) >= 3 && root {
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "index" {
+				_, dot := n.Args[1].(*parse.DotNode)
+				key, str := n.Args[2].(*parse.StringNode)
+
+				if dot && str {
+					w.vars[key.Text] = struct{}{}
+				}
+			}
+		}
+
+		for _, arg := range n.Args {
+			w.walk(arg, root)
+		}
+
+	case *parse.FieldNode:
+		if root {
+			w.vars[n.Ident[0]] = struct{}{}
+		}
+
+	case *parse.VariableNode:
+		// $ is always the data of the template
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			w.vars[n.Ident[1]] = struct{}{}
+		}
+
+	case *parse.ChainNode:
+		w.walk(n.Node, root)
+	}
+}
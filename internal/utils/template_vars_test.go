@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateVars(t *testing.T) {
+	var tests = []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"none", `SELECT 1`, nil},
+		{"fields", `SELECT {{.A}}, {{.B.C}} FROM {{ .A }}`, []string{"A", "B"}},
+		{"pipelines", `{{.A | printf "%s"}} {{printf "%s-%s" .B .C}} {{len .D}}`, []string{"A", "B", "C", "D"}},
+		{"if", `{{if .A}}{{.B}}{{else}}{{.C}}{{end}}`, []string{"A", "B", "C"}},
+		{"range", `{{range .A}}{{.B}}{{$.C}}{{else}}{{.D}}{{end}}`, []string{"A", "C", "D"}},
+		{"with", `{{with .A}}{{.B}}{{else}}{{.C}}{{end}}`, []string{"A", "C"}},
+		{"root var", `{{$.A}} {{$x := .B}}{{$x.C}}`, []string{"A", "B"}},
+		{"index", `{{index . "A"}} {{index .B "C"}}`, []string{"A", "B"}},
+		{"template with dot", `{{template "sub" .}} {{.A}}`, []string{"A", "S"}},
+		{"template with other data", `{{template "sub" .A}}`, []string{"A"}},
+		{"template without data", `{{template "sub"}}`, nil},
+		{"missing template", `{{template "missing" .}}{{.A}}`, []string{"A"}},
+		{"recursive template", `{{template "rec" .}}`, []string{"R"}},
+	}
+
+	for _, test := range tests {
+		var tmpl = template.Must(template.New("pipeline").Parse(`{{define "sub"}}{{.S}}{{end}}{{define "rec"}}{{.R}}{{template "rec" .}}{{end}}`))
+
+		if _, err := tmpl.New("test").Parse(test.text); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := TemplateVars(tmpl, "test"); !slices.Equal(got, test.want) {
+			t.Errorf("%s: TemplateVars(%s) = %v, want %v", test.name, test.text, got, test.want)
+		}
+	}
+
+	if got := TemplateVars(template.New("pipeline"), "unknown"); len(got) > 0 {
+		t.Errorf("TemplateVars of an unknown template = %v, want none", got)
+	}
+}